@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/pkg/errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// AdminHandler serves the operational endpoints inspecting and purging the cache of upstream responses.
+type AdminHandler struct {
+	Handler
+	cache cache.InspectableCache
+	token string
+}
+
+func NewAdminHandler(h Handler, c cache.InspectableCache, token string) AdminHandler {
+	return AdminHandler{
+		Handler: h,
+		cache:   c,
+		token:   token,
+	}
+}
+
+// CacheKeysResponse lists the keys of the cache.
+type CacheKeysResponse struct {
+	Keys []string `json:"keys"`
+}
+
+// CachePurgeResponse reports the number of keys deleted from the cache.
+type CachePurgeResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// MiddlewareAuth rejects the requests without an "Authorization: Bearer <token>" header matching the admin token.
+func (h AdminHandler) MiddlewareAuth(next http.Handler) http.Handler {
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		token, bearer := bearerToken(r)
+		if !bearer || h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			err := errors.New("a valid admin token is required")
+			h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusUnauthorized), w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(handlerFunc)
+}
+
+// GetCacheStatsHandler reports the hit, miss, eviction and size counters of the cache.
+func (h AdminHandler) GetCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.cache.Stats(r.Context())
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// GetCacheKeysHandler lists the sorted keys of the cache starting with the optional prefix query parameter.
+func (h AdminHandler) GetCacheKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.cache.Keys(r.Context(), r.URL.Query().Get("prefix"))
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	sort.Strings(keys)
+	if err = json.NewEncoder(w).Encode(CacheKeysResponse{Keys: keys}); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// DeleteCacheKeyHandler deletes a key of the cache, whether or not it is cached.
+func (h AdminHandler) DeleteCacheKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.cache.Delete(r.Context(), chi.URLParam(r, "key")); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	h.logger.Info().Str("key", chi.URLParam(r, "key")).Msg("cache key purged")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeCacheHandler deletes the keys of the cache starting with the required prefix query parameter.
+func (h AdminHandler) PurgeCacheHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		err := errors.New("the prefix query parameter is required")
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
+	deleted, err := h.cache.DeletePrefix(r.Context(), prefix)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	h.logger.Info().Str("prefix", prefix).Int("deleted", deleted).Msg("cache keys purged")
+	if err = json.NewEncoder(w).Encode(CachePurgeResponse{Deleted: deleted}); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// bearerToken returns the token of the Authorization header, and false if the header does not use the Bearer
+// scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	const scheme = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, scheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(auth, scheme), true
+}
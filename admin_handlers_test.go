@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewDefaultCache(time.Minute, time.Minute)
+	for _, key := range []string{"user-1", "user-2", "posts-user-1", "posts-user-2"} {
+		assert.NoError(t, c.Set(ctx, key, []byte("{}")))
+	}
+	handler := NewAdminHandler(NewHandler(new(MockUserClient), 0, zerolog.New(io.Discard)), c, "secret")
+	serve := func(method string, target string, token string, handlerFunc http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.MiddlewareAuth(handlerFunc).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		for _, token := range []string{"", "wrong"} {
+			recorder := serve(http.MethodGet, "/admin/cache/stats", token, handler.GetCacheStatsHandler)
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+			assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+		}
+	})
+
+	t.Run("token without the bearer scheme", func(t *testing.T) {
+		for _, auth := range []string{"secret", "Basic secret", "bearersecret"} {
+			req := httptest.NewRequest(http.MethodGet, "/admin/cache/stats", nil)
+			req.Header.Set("Authorization", auth)
+			recorder := httptest.NewRecorder()
+			handler.MiddlewareAuth(http.HandlerFunc(handler.GetCacheStatsHandler)).ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code, auth)
+		}
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		recorder := serve(http.MethodGet, "/admin/cache/keys?prefix=user-", "secret", handler.GetCacheKeysHandler)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var resp CacheKeysResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, []string{"user-1", "user-2"}, resp.Keys)
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		recorder := serve(http.MethodGet, "/admin/cache/stats", "secret", handler.GetCacheStatsHandler)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var stats cache.Stats
+		if err := json.NewDecoder(recorder.Body).Decode(&stats); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, 4, stats.Entries)
+		assert.Equal(t, int64(8), stats.Bytes)
+	})
+
+	t.Run("delete key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/cache/user-1", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("key", "user-1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		recorder := httptest.NewRecorder()
+		handler.MiddlewareAuth(http.HandlerFunc(handler.DeleteCacheKeyHandler)).ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		_, ok, _ := c.Get(ctx, "user-1")
+		assert.False(t, ok)
+	})
+
+	t.Run("purge prefix", func(t *testing.T) {
+		recorder := serve(http.MethodDelete, "/admin/cache?prefix=posts-user", "secret", handler.PurgeCacheHandler)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var resp CachePurgeResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, 2, resp.Deleted)
+		keys, _ := c.Keys(ctx, "")
+		assert.Equal(t, []string{"user-2"}, keys)
+	})
+
+	t.Run("purge without prefix", func(t *testing.T) {
+		recorder := serve(http.MethodDelete, "/admin/cache", "secret", handler.PurgeCacheHandler)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
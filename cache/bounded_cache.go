@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy selects the entry a BoundedCache evicts when it is full.
+type EvictionPolicy string
+
+const (
+	// EvictionLRU evicts the least recently used entry.
+	EvictionLRU EvictionPolicy = "lru"
+	// EvictionLFU evicts the least frequently used entry, and the least recently used of those on a tie.
+	EvictionLFU EvictionPolicy = "lfu"
+)
+
+// BoundedCache is an in-memory Cache holding at most maxEntries entries and maxBytes bytes of values, evicting
+// entries according to its EvictionPolicy to make room for new ones. A zero limit is not enforced. Expired
+// entries are removed when they are read or evicted.
+type BoundedCache struct {
+	mu                 sync.Mutex
+	policy             EvictionPolicy
+	maxEntries         int
+	maxBytes           int64
+	expirationDuration time.Duration
+	entries            map[string]*list.Element
+	// buckets holds the entries by use frequency, most recently used first. Every entry of a LRU cache is in
+	// the bucket of frequency 0.
+	buckets map[int]*list.List
+	minFreq int
+	stats   Stats
+}
+
+type boundedEntry struct {
+	key       string
+	value     interface{}
+	size      int64
+	expiresAt time.Time
+	freq      int
+}
+
+func NewBoundedCache(policy EvictionPolicy, maxEntries int, maxBytes int64, expirationDuration time.Duration) (*BoundedCache, error) {
+	if policy != EvictionLRU && policy != EvictionLFU {
+		return nil, fmt.Errorf("unknown eviction policy %q, expected lru or lfu", policy)
+	}
+	return &BoundedCache{
+		policy:             policy,
+		maxEntries:         maxEntries,
+		maxBytes:           maxBytes,
+		expirationDuration: expirationDuration,
+		entries:            make(map[string]*list.Element),
+		buckets:            make(map[int]*list.List),
+	}, nil
+}
+
+func (c *BoundedCache) Set(ctx context.Context, key string, value interface{}) error {
+	return c.SetWithTTL(ctx, key, value, c.expirationDuration)
+}
+
+// SetWithTTL stores the value under the key until the ttl has passed, or for the expiration duration of the
+// cache when the ttl is not positive. The value does not expire when neither is positive. Overwriting a key
+// keeps its use frequency, so that refreshing a frequently used entry does not make it the next one evicted.
+// A value larger than the byte budget of the cache is not stored.
+func (c *BoundedCache) SetWithTTL(_ context.Context, key string, value interface{}, ttl time.Duration) error {
+	size, err := sizeOf(value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	freq := 0
+	if el, ok := c.entries[key]; ok {
+		freq = el.Value.(*boundedEntry).freq
+		c.remove(el)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return fmt.Errorf("value of %d bytes exceeds the cache budget of %d bytes", size, c.maxBytes)
+	}
+	for c.full(size) {
+		c.evict()
+	}
+
+	e := &boundedEntry{key: key, value: value, size: size, freq: freq}
+	if ttl <= 0 {
+		ttl = c.expirationDuration
+	}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	c.entries[key] = c.bucket(freq).PushFront(e)
+	if freq < c.minFreq || len(c.entries) == 1 {
+		c.minFreq = freq
+	}
+	c.stats.Entries++
+	c.stats.Bytes += size
+	return nil
+}
+
+func (c *BoundedCache) Get(_ context.Context, key string) (interface{}, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false, nil
+	}
+	e := el.Value.(*boundedEntry)
+	if e.expired(time.Now()) {
+		c.remove(el)
+		c.stats.Misses++
+		return nil, false, nil
+	}
+	c.touch(el)
+	c.stats.Hits++
+	return e.value, true, nil
+}
+
+func (c *BoundedCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Clear deletes every entry of the cache. The hit, miss and eviction counters are kept.
+func (c *BoundedCache) Clear(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.buckets = make(map[int]*list.List)
+	c.minFreq = 0
+	c.stats.Entries = 0
+	c.stats.Bytes = 0
+	return nil
+}
+
+func (c *BoundedCache) Keys(_ context.Context, prefix string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) && !el.Value.(*boundedEntry).expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (c *BoundedCache) DeletePrefix(_ context.Context, prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Stats returns a snapshot of the counters of the cache. Like Keys, the number and size of the entries leave out
+// the expired entries that have not been removed yet.
+func (c *BoundedCache) Stats(_ context.Context) (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	now := time.Now()
+	for _, el := range c.entries {
+		if e := el.Value.(*boundedEntry); e.expired(now) {
+			stats.Entries--
+			stats.Bytes -= e.size
+		}
+	}
+	return stats, nil
+}
+
+// full reports whether an entry of the size does not fit in the cache without an eviction.
+func (c *BoundedCache) full(size int64) bool {
+	if len(c.entries) == 0 {
+		return false
+	}
+	return (c.maxEntries > 0 && len(c.entries) >= c.maxEntries) ||
+		(c.maxBytes > 0 && c.stats.Bytes+size > c.maxBytes)
+}
+
+// evict removes the least recently used entry of the lowest use frequency.
+func (c *BoundedCache) evict() {
+	b, ok := c.buckets[c.minFreq]
+	if !ok {
+		c.minFreq = -1
+		for freq := range c.buckets {
+			if c.minFreq < 0 || freq < c.minFreq {
+				c.minFreq = freq
+			}
+		}
+		b = c.buckets[c.minFreq]
+	}
+	c.remove(b.Back())
+	c.stats.Evictions++
+}
+
+// touch records a use of the entry, moving it to the front of its bucket, or to the next bucket for a LFU cache.
+func (c *BoundedCache) touch(el *list.Element) {
+	e := el.Value.(*boundedEntry)
+	if c.policy == EvictionLRU {
+		c.buckets[e.freq].MoveToFront(el)
+		return
+	}
+	c.unlink(el)
+	e.freq++
+	c.entries[e.key] = c.bucket(e.freq).PushFront(e)
+	if _, ok := c.buckets[c.minFreq]; !ok && c.minFreq == e.freq-1 {
+		c.minFreq = e.freq
+	}
+}
+
+func (c *BoundedCache) remove(el *list.Element) {
+	e := el.Value.(*boundedEntry)
+	c.unlink(el)
+	delete(c.entries, e.key)
+	c.stats.Entries--
+	c.stats.Bytes -= e.size
+}
+
+// unlink removes the entry from its bucket, dropping the bucket once it is empty.
+func (c *BoundedCache) unlink(el *list.Element) {
+	e := el.Value.(*boundedEntry)
+	b := c.buckets[e.freq]
+	b.Remove(el)
+	if b.Len() == 0 {
+		delete(c.buckets, e.freq)
+	}
+}
+
+func (c *BoundedCache) bucket(freq int) *list.List {
+	b, ok := c.buckets[freq]
+	if !ok {
+		b = list.New()
+		c.buckets[freq] = b
+	}
+	return b
+}
+
+func (e *boundedEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// sizeOf returns the size of a []byte or string value, and the size of the JSON encoding of any other value.
+func sizeOf(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(v)), nil
+	case string:
+		return int64(len(v)), nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(b)), nil
+}
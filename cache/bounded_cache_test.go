@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBoundedCache(t *testing.T) {
+	ctx := context.Background()
+	cached := func(c *BoundedCache, key string) bool {
+		_, ok, _ := c.Get(ctx, key)
+		return ok
+	}
+	stats := func(c *BoundedCache) Stats {
+		s, _ := c.Stats(ctx)
+		return s
+	}
+
+	t.Run("unknown policy", func(t *testing.T) {
+		_, err := NewBoundedCache("fifo", 10, 0, time.Minute)
+		assert.Error(t, err)
+	})
+
+	t.Run("lru evicts the least recently used entry", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLRU, 2, 0, time.Minute)
+		assert.NoError(t, c.Set(ctx, "a", []byte("1")))
+		assert.NoError(t, c.Set(ctx, "b", []byte("2")))
+		assert.True(t, cached(c, "a"))
+		assert.NoError(t, c.Set(ctx, "c", []byte("3")))
+
+		assert.True(t, cached(c, "a"))
+		assert.False(t, cached(c, "b"))
+		assert.True(t, cached(c, "c"))
+		assert.Equal(t, Stats{Hits: 3, Misses: 1, Evictions: 1, Entries: 2, Bytes: 2}, stats(c))
+	})
+
+	t.Run("lfu evicts the least frequently used entry", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLFU, 2, 0, time.Minute)
+		assert.NoError(t, c.Set(ctx, "a", []byte("1")))
+		assert.NoError(t, c.Set(ctx, "b", []byte("2")))
+		assert.True(t, cached(c, "a"))
+		assert.NoError(t, c.Set(ctx, "c", []byte("3")))
+		assert.True(t, cached(c, "a"))
+		assert.False(t, cached(c, "b"))
+		assert.NoError(t, c.Set(ctx, "d", []byte("4")))
+		assert.True(t, cached(c, "a"))
+		assert.False(t, cached(c, "c"))
+		assert.True(t, cached(c, "d"))
+	})
+
+	t.Run("lfu keeps the frequency of a refreshed entry", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLFU, 2, 0, time.Minute)
+		assert.NoError(t, c.Set(ctx, "a", []byte("1")))
+		assert.True(t, cached(c, "a"))
+		assert.True(t, cached(c, "a"))
+		assert.NoError(t, c.Set(ctx, "b", []byte("2")))
+		assert.NoError(t, c.Set(ctx, "a", []byte("refreshed")))
+		assert.NoError(t, c.Set(ctx, "c", []byte("3")))
+
+		assert.True(t, cached(c, "a"))
+		assert.False(t, cached(c, "b"))
+		assert.True(t, cached(c, "c"))
+	})
+
+	t.Run("byte budget", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLRU, 0, 10, time.Minute)
+		assert.NoError(t, c.Set(ctx, "a", []byte("12345")))
+		assert.NoError(t, c.Set(ctx, "b", []byte("12345")))
+		assert.NoError(t, c.Set(ctx, "c", []byte("123")))
+		assert.False(t, cached(c, "a"))
+		assert.Equal(t, int64(8), stats(c).Bytes)
+
+		assert.Error(t, c.Set(ctx, "large", []byte("12345678901")))
+		assert.False(t, cached(c, "large"))
+	})
+
+	t.Run("replacing a value updates its size", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLRU, 0, 10, time.Minute)
+		assert.NoError(t, c.Set(ctx, "a", []byte("12345")))
+		assert.NoError(t, c.Set(ctx, "a", []byte("12")))
+		assert.Equal(t, Stats{Entries: 1, Bytes: 2}, stats(c))
+	})
+
+	t.Run("per key ttl", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLRU, 10, 0, time.Minute)
+		assert.NoError(t, c.SetWithTTL(ctx, "short", []byte("1"), time.Millisecond))
+		assert.NoError(t, c.Set(ctx, "long", []byte("2")))
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(t, 1, stats(c).Entries, "expired entries are not counted before they are removed")
+		assert.Equal(t, int64(1), stats(c).Bytes)
+
+		assert.False(t, cached(c, "short"))
+		assert.True(t, cached(c, "long"))
+		assert.Equal(t, 1, stats(c).Entries)
+	})
+
+	t.Run("delete and clear", func(t *testing.T) {
+		c, _ := NewBoundedCache(EvictionLFU, 10, 0, time.Minute)
+		assert.NoError(t, c.Set(ctx, "a", []byte("1")))
+		assert.NoError(t, c.Set(ctx, "b", []byte("2")))
+		assert.NoError(t, c.Delete(ctx, "a"))
+		assert.False(t, cached(c, "a"))
+		assert.NoError(t, c.Clear(ctx))
+		assert.False(t, cached(c, "b"))
+		assert.Equal(t, Stats{Misses: 2}, stats(c))
+	})
+}
@@ -1,12 +1,88 @@
 package cache
 
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores values under string keys. A network-backed Cache honors the cancellation of the context
+// and reports its failures as errors, so callers can fall back to the source of the values.
 type Cache interface {
-	Set(key string, value interface{})
-	Get(key string) (interface{}, bool)
+	// Get returns the value stored under the key, and false if there is none.
+	Get(ctx context.Context, key string) (interface{}, bool, error)
+	// Set stores the value under the key for the default expiration of the Cache.
+	Set(ctx context.Context, key string, value interface{}) error
+	// SetWithTTL stores the value under the key until the ttl has passed. A ttl of zero or less stores it for
+	// the default expiration of the Cache, like Set, and a Cache without a default expiration keeps it forever.
+	SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Clear deletes every key of the Cache.
+	Clear(ctx context.Context) error
+}
+
+// InspectableCache is a Cache whose keys can be enumerated and purged, and whose usage is reported in Stats.
+type InspectableCache interface {
+	Cache
+	// Keys returns the keys starting with the prefix, in no particular order.
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	// DeletePrefix deletes every key starting with the prefix and returns the number of deleted keys.
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// Stats are the usage counters of a Cache. Counters that a Cache cannot track are zero.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// counters tracks the hits and misses of a Cache safe for concurrent use.
+type counters struct {
+	hits   uint64
+	misses uint64
+}
+
+func (c *counters) record(hit bool) {
+	if hit {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+func (c *counters) stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
 }
 
 type NullCache struct {}
-func (c NullCache) Get(_ string) (interface{}, bool) {
-	return nil, false
+func (c NullCache) Get(_ context.Context, _ string) (interface{}, bool, error) {
+	return nil, false, nil
+}
+func (c NullCache) Set(_ context.Context, _ string, _ interface{}) error {
+	return nil
+}
+func (c NullCache) SetWithTTL(_ context.Context, _ string, _ interface{}, _ time.Duration) error {
+	return nil
+}
+func (c NullCache) Delete(_ context.Context, _ string) error {
+	return nil
+}
+func (c NullCache) Clear(_ context.Context) error {
+	return nil
+}
+func (c NullCache) Keys(_ context.Context, _ string) ([]string, error) {
+	return nil, nil
+}
+func (c NullCache) DeletePrefix(_ context.Context, _ string) (int, error) {
+	return 0, nil
+}
+func (c NullCache) Stats(_ context.Context) (Stats, error) {
+	return Stats{}, nil
 }
-func (c NullCache) Set(_ string, _ interface{}) {}
\ No newline at end of file
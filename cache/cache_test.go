@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestInspectableCache(t *testing.T) {
+	ctx := context.Background()
+	caches := map[string]func(t *testing.T) InspectableCache{
+		"default": func(t *testing.T) InspectableCache {
+			return NewDefaultCache(time.Minute, time.Minute)
+		},
+		"bounded": func(t *testing.T) InspectableCache {
+			c, _ := NewBoundedCache(EvictionLRU, 10, 0, time.Minute)
+			return c
+		},
+		"redis": func(t *testing.T) InspectableCache {
+			s := miniredis.RunT(t)
+			return NewRedisCache(redis.NewClient(&redis.Options{Addr: s.Addr()}), "test", time.Minute)
+		},
+		"tiered": func(t *testing.T) InspectableCache {
+			c, err := NewTieredCache(ctx, NewDefaultCache(time.Minute, time.Minute), time.Minute, NewDefaultCache(time.Minute, time.Minute), NewMemoryBus())
+			assert.NoError(t, err)
+			return c
+		},
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			c := newCache(t)
+			for _, key := range []string{"user-1", "user-2", "posts-user-1", "weird*key"} {
+				assert.NoError(t, c.Set(ctx, key, []byte("value")))
+			}
+			_, _, _ = c.Get(ctx, "user-1")
+			_, _, _ = c.Get(ctx, "user-3")
+
+			keys, err := c.Keys(ctx, "user-")
+			assert.NoError(t, err)
+			sort.Strings(keys)
+			assert.Equal(t, []string{"user-1", "user-2"}, keys)
+			keys, err = c.Keys(ctx, "weird*")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"weird*key"}, keys)
+
+			stats, err := c.Stats(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(1), stats.Hits)
+			assert.Equal(t, uint64(1), stats.Misses)
+			assert.Equal(t, 4, stats.Entries)
+
+			deleted, err := c.DeletePrefix(ctx, "user-")
+			assert.NoError(t, err)
+			assert.Equal(t, 2, deleted)
+			_, ok, _ := c.Get(ctx, "user-2")
+			assert.False(t, ok)
+			_, ok, _ = c.Get(ctx, "posts-user-1")
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestSetWithZeroTTL(t *testing.T) {
+	ctx := context.Background()
+	const expiration = 20 * time.Millisecond
+	wait := func() { time.Sleep(2 * expiration) }
+	caches := map[string]func(t *testing.T) (Cache, func()){
+		"default": func(t *testing.T) (Cache, func()) {
+			return NewDefaultCache(expiration, time.Minute), wait
+		},
+		"bounded": func(t *testing.T) (Cache, func()) {
+			c, _ := NewBoundedCache(EvictionLFU, 10, 0, expiration)
+			return c, wait
+		},
+		"redis": func(t *testing.T) (Cache, func()) {
+			s := miniredis.RunT(t)
+			c := NewRedisCache(redis.NewClient(&redis.Options{Addr: s.Addr()}), "test", expiration)
+			return c, func() { s.FastForward(2 * expiration) }
+		},
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			c, expire := newCache(t)
+			assert.NoError(t, c.SetWithTTL(ctx, "zero", []byte("value"), 0))
+			assert.NoError(t, c.SetWithTTL(ctx, "negative", []byte("value"), -time.Second))
+			assert.NoError(t, c.SetWithTTL(ctx, "hour", []byte("value"), time.Hour))
+			expire()
+
+			for key, expected := range map[string]bool{"zero": false, "negative": false, "hour": true} {
+				_, ok, err := c.Get(ctx, key)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, ok, key)
+			}
+		})
+	}
+}
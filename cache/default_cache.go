@@ -1,13 +1,16 @@
 package cache
 
 import (
+	"context"
 	"github.com/patrickmn/go-cache"
+	"strings"
 	"time"
 )
 
 type DefaultCache struct {
 	underlying *cache.Cache
 	expirationDuration time.Duration
+	counters *counters
 }
 
 func NewDefaultCache(expirationDuration time.Duration, cleanupInterval time.Duration) DefaultCache {
@@ -15,13 +18,66 @@ func NewDefaultCache(expirationDuration time.Duration, cleanupInterval time.Dura
 	return DefaultCache{
 		underlying: c,
 		expirationDuration: expirationDuration,
+		counters: &counters{},
 	}
 }
 
-func (c DefaultCache) Set(key string, value interface{}) {
-	c.underlying.Set(key, value, c.expirationDuration)
+func (c DefaultCache) Set(ctx context.Context, key string, value interface{}) error {
+	return c.SetWithTTL(ctx, key, value, c.expirationDuration)
 }
 
-func (c DefaultCache) Get(key string) (interface{}, bool) {
-	return c.underlying.Get(key)
+func (c DefaultCache) SetWithTTL(_ context.Context, key string, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = cache.DefaultExpiration
+	}
+	c.underlying.Set(key, value, ttl)
+	return nil
+}
+
+func (c DefaultCache) Get(_ context.Context, key string) (interface{}, bool, error) {
+	v, ok := c.underlying.Get(key)
+	c.counters.record(ok)
+	return v, ok, nil
+}
+
+func (c DefaultCache) Delete(_ context.Context, key string) error {
+	c.underlying.Delete(key)
+	return nil
+}
+
+func (c DefaultCache) Clear(_ context.Context) error {
+	c.underlying.Flush()
+	return nil
+}
+
+func (c DefaultCache) Keys(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range c.underlying.Items() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (c DefaultCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	keys, _ := c.Keys(ctx, prefix)
+	for _, key := range keys {
+		c.underlying.Delete(key)
+	}
+	return len(keys), nil
+}
+
+// Stats reports the hits and misses, and the number and size of the unexpired entries.
+func (c DefaultCache) Stats(_ context.Context) (Stats, error) {
+	stats := c.counters.stats()
+	for _, item := range c.underlying.Items() {
+		size, err := sizeOf(item.Object)
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.Entries++
+		stats.Bytes += size
+	}
+	return stats, nil
 }
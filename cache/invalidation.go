@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+	"io"
+	"sync"
+)
+
+// Invalidation notifies the replicas of the service that a key, every key starting with Prefix, or every key
+// when Clear is set, has changed. Origin identifies the publisher so that it can ignore its own invalidations.
+type Invalidation struct {
+	Origin string `json:"origin"`
+	Key    string `json:"key,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Clear  bool   `json:"clear,omitempty"`
+}
+
+// InvalidationBus fans out invalidations to every subscriber, including the ones of other replicas.
+type InvalidationBus interface {
+	Publish(ctx context.Context, inv Invalidation) error
+	// Subscribe calls the handler with every published invalidation until the returned io.Closer is closed.
+	Subscribe(ctx context.Context, handler func(Invalidation)) (io.Closer, error)
+}
+
+// MemoryBus is an InvalidationBus delivering invalidations synchronously to the subscribers of this process.
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers map[int]func(Invalidation)
+	nextID   int
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{handlers: make(map[int]func(Invalidation))}
+}
+
+func (b *MemoryBus) Publish(_ context.Context, inv Invalidation) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(inv)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(_ context.Context, handler func(Invalidation)) (io.Closer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handler
+	return closerFunc(func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+		return nil
+	}), nil
+}
+
+// RedisBus is an InvalidationBus publishing invalidations as JSON to a Redis channel, so that they reach every
+// replica connected to the same Redis server.
+type RedisBus struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisBus(client *redis.Client, channel string) RedisBus {
+	return RedisBus{
+		client:  client,
+		channel: channel,
+	}
+}
+
+func (b RedisBus) Publish(ctx context.Context, inv Invalidation) error {
+	msg, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, msg).Err()
+}
+
+// Subscribe returns once the subscription is confirmed by the Redis server. Malformed messages are logged and
+// skipped.
+func (b RedisBus) Subscribe(ctx context.Context, handler func(Invalidation)) (io.Closer, error) {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+	go func() {
+		for msg := range pubsub.Channel() {
+			var inv Invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				log.Warn().Err(err).Str("channel", b.channel).Msg("unable to decode cache invalidation")
+				continue
+			}
+			handler(inv)
+		}
+	}()
+	return pubsub, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+)
+
+// GetJSON decodes the JSON value stored under the key into v. It reports whether the key was found, and
+// returns an error when the Cache fails or the stored value is not valid JSON for v.
+func GetJSON(ctx context.Context, c Cache, key string, v interface{}) (bool, error) {
+	value, ok, err := c.Get(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return false, errors.Errorf("cached value of %s is a %T, expected JSON bytes", key, value)
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return false, errors.Wrapf(err, "unable to decode cached value of %s", key)
+	}
+	return true, nil
+}
+
+// SetJSON stores v encoded as JSON under the key. Values are serialized explicitly so that they survive the
+// round trip through a Cache that is not in-process.
+func SetJSON(ctx context.Context, c Cache, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, b)
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	type post struct {
+		Id    int    `json:"id"`
+		Title string `json:"title"`
+	}
+	ctx := context.Background()
+	c := NewDefaultCache(time.Minute, time.Minute)
+
+	assert.NoError(t, SetJSON(ctx, c, "posts", []post{{Id: 1, Title: "title"}}))
+	var posts []post
+	ok, err := GetJSON(ctx, c, "posts", &posts)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []post{{Id: 1, Title: "title"}}, posts)
+
+	ok, err = GetJSON(ctx, c, "absent", &posts)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, c.Set(ctx, "not-bytes", "a string"))
+	ok, err = GetJSON(ctx, c, "not-bytes", &posts)
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, c.Set(ctx, "not-json", []byte("{")))
+	ok, err = GetJSON(ctx, c, "not-json", &posts)
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
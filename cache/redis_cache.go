@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"time"
+)
+
+// clearBatchSize is the number of keys scanned and deleted at a time when a RedisCache is cleared.
+const clearBatchSize = 500
+
+// globEscaper escapes the special characters of a Redis glob-style pattern.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// RedisCache is a Cache shared by every replica of the service. Values are stored as JSON under keys prefixed
+// by the namespace, and expire after the expiration duration.
+type RedisCache struct {
+	client             *redis.Client
+	namespace          string
+	expirationDuration time.Duration
+	counters           *counters
+}
+
+func NewRedisCache(client *redis.Client, namespace string, expirationDuration time.Duration) RedisCache {
+	return RedisCache{
+		client:             client,
+		namespace:          namespace,
+		expirationDuration: expirationDuration,
+		counters:           &counters{},
+	}
+}
+
+func (c RedisCache) Set(ctx context.Context, key string, value interface{}) error {
+	return c.SetWithTTL(ctx, key, value, c.expirationDuration)
+}
+
+// SetWithTTL stores the value as is if it is a []byte, and as JSON otherwise.
+func (c RedisCache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	b, ok := value.([]byte)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+	if ttl <= 0 {
+		ttl = c.expirationDuration
+	}
+	if ttl < 0 {
+		// a negative expiration keeps the ttl of an existing key in Redis
+		ttl = 0
+	}
+	return c.client.Set(ctx, c.namespacedKey(key), b, ttl).Err()
+}
+
+// Get returns the []byte stored under the key.
+func (c RedisCache) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	b, err := c.client.Get(ctx, c.namespacedKey(key)).Bytes()
+	if err == redis.Nil {
+		c.counters.record(false)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	c.counters.record(true)
+	return b, true, nil
+}
+
+func (c RedisCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.namespacedKey(key)).Err()
+}
+
+// Clear deletes every key of the namespace, or flushes the whole database when the cache is not namespaced.
+func (c RedisCache) Clear(ctx context.Context) error {
+	if c.namespace == "" {
+		return c.client.FlushDB(ctx).Err()
+	}
+	_, err := c.DeletePrefix(ctx, "")
+	return err
+}
+
+func (c RedisCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := c.scan(ctx, prefix, func(batch []string) error {
+		for _, key := range batch {
+			keys = append(keys, strings.TrimPrefix(key, c.namespacedKey("")))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// DeletePrefix scans and deletes the keys of the namespace starting with the prefix in batches.
+func (c RedisCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	deleted := 0
+	err := c.scan(ctx, prefix, func(batch []string) error {
+		n, err := c.client.Del(ctx, batch...).Result()
+		deleted += int(n)
+		return err
+	})
+	return deleted, err
+}
+
+// Stats reports the hits and misses of this replica, and the number of keys of the namespace.
+func (c RedisCache) Stats(ctx context.Context) (Stats, error) {
+	stats := c.counters.stats()
+	err := c.scan(ctx, "", func(batch []string) error {
+		stats.Entries += len(batch)
+		return nil
+	})
+	return stats, err
+}
+
+// scan calls fn with the namespaced keys starting with the prefix, at most clearBatchSize keys at a time.
+func (c RedisCache) scan(ctx context.Context, prefix string, fn func(batch []string) error) error {
+	iter := c.client.Scan(ctx, 0, c.namespacedKey(globEscaper.Replace(prefix))+"*", clearBatchSize).Iterator()
+	keys := make([]string, 0, clearBatchSize)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == clearBatchSize {
+			if err := fn(keys); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return fn(keys)
+	}
+	return nil
+}
+
+func (c RedisCache) namespacedKey(key string) string {
+	if c.namespace == "" {
+		return key
+	}
+	return fmt.Sprintf("%s:%s", c.namespace, key)
+}
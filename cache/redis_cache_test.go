@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	c := NewRedisCache(redis.NewClient(&redis.Options{Addr: s.Addr()}), "test", time.Minute)
+
+	t.Run("miss", func(t *testing.T) {
+		_, ok, err := c.Get(ctx, "absent")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("set and get bytes", func(t *testing.T) {
+		assert.NoError(t, c.Set(ctx, "bytes", []byte(`{"id":1}`)))
+		v, ok, err := c.Get(ctx, "bytes")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte(`{"id":1}`), v)
+	})
+
+	t.Run("values are namespaced and expire", func(t *testing.T) {
+		assert.NoError(t, c.Set(ctx, "ttl", []byte("value")))
+		assert.True(t, s.Exists("test:ttl"))
+		assert.Equal(t, time.Minute, s.TTL("test:ttl"))
+
+		s.FastForward(time.Minute)
+		_, ok, err := c.Get(ctx, "ttl")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("set with ttl", func(t *testing.T) {
+		assert.NoError(t, c.SetWithTTL(ctx, "short", []byte("value"), time.Second))
+		assert.Equal(t, time.Second, s.TTL("test:short"))
+	})
+
+	t.Run("non byte values are stored as JSON", func(t *testing.T) {
+		assert.NoError(t, c.Set(ctx, "struct", struct {
+			Id int `json:"id"`
+		}{Id: 2}))
+		v, ok, err := c.Get(ctx, "struct")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte(`{"id":2}`), v)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, c.Set(ctx, "deleted", []byte("value")))
+		assert.NoError(t, c.Delete(ctx, "deleted"))
+		_, ok, err := c.Get(ctx, "deleted")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("clear only deletes the namespace", func(t *testing.T) {
+		assert.NoError(t, s.Set("other:key", "value"))
+		for i := 0; i < clearBatchSize+1; i++ {
+			assert.NoError(t, c.Set(ctx, time.Duration(i).String(), []byte("value")))
+		}
+		assert.NoError(t, c.Clear(ctx))
+		assert.Equal(t, []string{"other:key"}, s.Keys())
+	})
+
+	t.Run("unavailable redis returns errors", func(t *testing.T) {
+		unavailable := miniredis.NewMiniRedis()
+		assert.NoError(t, unavailable.Start())
+		down := NewRedisCache(redis.NewClient(&redis.Options{Addr: unavailable.Addr(), MaxRetries: -1}), "test", time.Minute)
+		unavailable.Close()
+
+		assert.Error(t, down.Set(ctx, "key", []byte("value")))
+		_, ok, err := down.Get(ctx, "key")
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, _, err := c.Get(cancelled, "bytes")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
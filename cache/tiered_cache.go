@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+// TieredCache is a Cache reading from a local cache first and from a cache shared by every replica second,
+// filling the local cache on a hit of the shared one. Writes go to both caches and are published to the
+// InvalidationBus, so that the other replicas drop their local copy of the key. A local copy expires after the
+// local TTL at most, which bounds how long a replica serves a stale copy after missing an invalidation.
+type TieredCache struct {
+	local        InspectableCache
+	localTTL     time.Duration
+	shared       InspectableCache
+	bus          InvalidationBus
+	id           string
+	subscription io.Closer
+	counters     *counters
+}
+
+// NewTieredCache subscribes the local cache to the invalidations of the other replicas until the TieredCache
+// is closed. The localTTL should be the default expiration of the local cache.
+func NewTieredCache(ctx context.Context, local InspectableCache, localTTL time.Duration, shared InspectableCache, bus InvalidationBus) (*TieredCache, error) {
+	id, err := newOriginID()
+	if err != nil {
+		return nil, err
+	}
+	c := &TieredCache{
+		local:    local,
+		localTTL: localTTL,
+		shared:   shared,
+		bus:      bus,
+		id:       id,
+		counters: &counters{},
+	}
+	if c.subscription, err = bus.Subscribe(ctx, c.invalidate); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get fills the local cache on a hit of the shared cache. A failing local cache is bypassed.
+func (c *TieredCache) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	if v, ok, err := c.local.Get(ctx, key); err == nil && ok {
+		c.counters.record(true)
+		return v, true, nil
+	}
+	v, ok, err := c.shared.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	c.counters.record(ok)
+	if !ok {
+		return nil, false, nil
+	}
+	_ = c.local.Set(ctx, key, v)
+	return v, true, nil
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value interface{}) error {
+	return c.update(ctx, Invalidation{Key: key}, func(cc Cache, _ bool) error {
+		return cc.Set(ctx, key, value)
+	})
+}
+
+// SetWithTTL stores the value in the shared cache until the ttl has passed, and in the local cache until the
+// ttl or the local TTL has passed, whichever comes first.
+func (c *TieredCache) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.update(ctx, Invalidation{Key: key}, func(cc Cache, local bool) error {
+		if local && c.localTTL > 0 && (ttl <= 0 || ttl > c.localTTL) {
+			return cc.SetWithTTL(ctx, key, value, c.localTTL)
+		}
+		return cc.SetWithTTL(ctx, key, value, ttl)
+	})
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	return c.update(ctx, Invalidation{Key: key}, func(cc Cache, _ bool) error {
+		return cc.Delete(ctx, key)
+	})
+}
+
+func (c *TieredCache) Clear(ctx context.Context) error {
+	return c.update(ctx, Invalidation{Clear: true}, func(cc Cache, _ bool) error {
+		return cc.Clear(ctx)
+	})
+}
+
+// Keys returns the keys of the shared cache.
+func (c *TieredCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	return c.shared.Keys(ctx, prefix)
+}
+
+// DeletePrefix returns the number of keys deleted from the shared cache.
+func (c *TieredCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	deleted, err := c.shared.DeletePrefix(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	_, localErr := c.local.DeletePrefix(ctx, prefix)
+	if err = c.bus.Publish(ctx, Invalidation{Origin: c.id, Prefix: prefix, Clear: prefix == ""}); err != nil {
+		return deleted, err
+	}
+	return deleted, localErr
+}
+
+// Stats reports the hits and misses of either cache, the evictions of the local cache, and the number and size
+// of the entries of the shared cache.
+func (c *TieredCache) Stats(ctx context.Context) (Stats, error) {
+	local, err := c.local.Stats(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats, err := c.shared.Stats(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	hits := c.counters.stats()
+	stats.Hits, stats.Misses, stats.Evictions = hits.Hits, hits.Misses, local.Evictions
+	return stats, nil
+}
+
+// Close stops listening to the invalidations of the other replicas.
+func (c *TieredCache) Close() error {
+	return c.subscription.Close()
+}
+
+// update applies the change to the shared cache and then to the local cache. The invalidation is published
+// even if the local cache fails, so that no other replica keeps serving its stale copy.
+func (c *TieredCache) update(ctx context.Context, inv Invalidation, change func(cc Cache, local bool) error) error {
+	if err := change(c.shared, false); err != nil {
+		return err
+	}
+	localErr := change(c.local, true)
+	inv.Origin = c.id
+	if err := c.bus.Publish(ctx, inv); err != nil {
+		return err
+	}
+	return localErr
+}
+
+// invalidate drops the local copy of a key changed by another replica.
+func (c *TieredCache) invalidate(inv Invalidation) {
+	if inv.Origin == c.id {
+		return
+	}
+	ctx := context.Background()
+	if inv.Clear {
+		_ = c.local.Clear(ctx)
+		return
+	}
+	if inv.Prefix != "" {
+		_, _ = c.local.DeletePrefix(ctx, inv.Prefix)
+		return
+	}
+	_ = c.local.Delete(ctx, inv.Key)
+}
+
+// newOriginID returns a random identifier of the publisher of invalidations.
+func newOriginID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
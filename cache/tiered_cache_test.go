@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+	// newReplicas returns two tiered caches sharing the cache and the bus, and the local cache of the first one
+	newReplicas := func(t *testing.T, bus InvalidationBus) (*TieredCache, *TieredCache, Cache) {
+		shared := NewDefaultCache(time.Minute, time.Minute)
+		local := NewDefaultCache(time.Minute, time.Minute)
+		a, err := NewTieredCache(ctx, local, time.Minute, shared, bus)
+		assert.NoError(t, err)
+		b, err := NewTieredCache(ctx, NewDefaultCache(time.Minute, time.Minute), time.Minute, shared, bus)
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_ = a.Close()
+			_ = b.Close()
+		})
+		return a, b, local
+	}
+
+	t.Run("shared hit fills the local cache", func(t *testing.T) {
+		a, b, local := newReplicas(t, NewMemoryBus())
+		assert.NoError(t, b.Set(ctx, "key", []byte("value")))
+
+		v, ok, err := a.Get(ctx, "key")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("value"), v)
+		v, ok, _ = local.Get(ctx, "key")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("value"), v)
+	})
+
+	t.Run("writes invalidate the local copy of the other replicas", func(t *testing.T) {
+		a, b, local := newReplicas(t, NewMemoryBus())
+		assert.NoError(t, a.Set(ctx, "key", []byte("old")))
+		assert.NoError(t, b.SetWithTTL(ctx, "key", []byte("new"), time.Minute))
+
+		_, ok, _ := local.Get(ctx, "key")
+		assert.False(t, ok)
+		v, _, _ := a.Get(ctx, "key")
+		assert.Equal(t, []byte("new"), v)
+
+		assert.NoError(t, b.Delete(ctx, "key"))
+		_, ok, _ = a.Get(ctx, "key")
+		assert.False(t, ok)
+	})
+
+	t.Run("own writes keep the local copy", func(t *testing.T) {
+		a, _, local := newReplicas(t, NewMemoryBus())
+		assert.NoError(t, a.Set(ctx, "key", []byte("value")))
+		_, ok, _ := local.Get(ctx, "key")
+		assert.True(t, ok)
+	})
+
+	t.Run("local copy expires after the local ttl", func(t *testing.T) {
+		shared := NewDefaultCache(time.Minute, time.Minute)
+		local := NewDefaultCache(20*time.Millisecond, time.Minute)
+		c, err := NewTieredCache(ctx, local, 20*time.Millisecond, shared, NewMemoryBus())
+		assert.NoError(t, err)
+		defer c.Close()
+		assert.NoError(t, c.SetWithTTL(ctx, "key", []byte("value"), time.Hour))
+
+		time.Sleep(40 * time.Millisecond)
+		_, ok, _ := local.Get(ctx, "key")
+		assert.False(t, ok)
+		_, ok, _ = shared.Get(ctx, "key")
+		assert.True(t, ok)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		a, b, local := newReplicas(t, NewMemoryBus())
+		assert.NoError(t, a.Set(ctx, "key", []byte("value")))
+		assert.NoError(t, b.Clear(ctx))
+		_, ok, _ := local.Get(ctx, "key")
+		assert.False(t, ok)
+	})
+
+	t.Run("invalidations over redis", func(t *testing.T) {
+		s := miniredis.RunT(t)
+		bus := NewRedisBus(redis.NewClient(&redis.Options{Addr: s.Addr()}), "invalidations")
+		a, b, local := newReplicas(t, bus)
+		assert.NoError(t, a.Set(ctx, "key", []byte("old")))
+		assert.NoError(t, b.Set(ctx, "key", []byte("new")))
+
+		assert.Eventually(t, func() bool {
+			_, ok, _ := local.Get(ctx, "key")
+			return !ok
+		}, time.Second, 5*time.Millisecond)
+	})
+}
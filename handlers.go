@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
@@ -9,28 +13,147 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
 	"runtime/debug"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// defaultListLimit is the page size of a listing when no limit is requested.
+const defaultListLimit = 10
+
+// maxBatchSize is the largest number of user ids accepted by a batch lookup.
+const maxBatchSize = 100
+
+// maxConcurrentBatchFetches limits how many users of a batch lookup are fetched at once.
+const maxConcurrentBatchFetches = 5
+
+// maxConcurrentCommentFetches limits how many comment fetches run at once when comments are expanded
+// into a user-posts response.
+const maxConcurrentCommentFetches = 5
+
 type UserInfoResponse struct {
 	Id       int 		`json:"id"`
 	UserInfo UserInfo 	`json:"userInfo"`
 	Posts 	[]UserPost	`json:"posts"`
+	// Todos is omitted when the todos of the user cannot be fetched.
+	Todos    *TodoSummary `json:"todos,omitempty"`
 }
 type UserInfo struct {
 	Name     string `json:"name"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 }
+// UserPost is a post of a user. The title and body are nil, and omitted from the response, when they are not
+// part of the requested fields.
 type UserPost struct {
+	Id       int           `json:"id"`
+	Title    *string       `json:"title,omitempty"`
+	Body     *string       `json:"body,omitempty"`
+	Comments []PostComment `json:"comments,omitempty"`
+}
+
+// postFields are the UserPost fields that can be selected with the fields query parameter of the user-posts
+// routes. The id of a post is always returned.
+var postFields = []string{"id", "title", "body"}
+
+// userPostsOptions shapes a user-posts response.
+type userPostsOptions struct {
+	expandComments bool
+	query          user.PostQuery
+	// fields are the UserPost fields that are returned, every field when nil
+	fields map[string]bool
+}
+// UserProfileResponse is the full profile of a user. Every section but the id is nil, and omitted from the
+// response, when it is not part of the requested fields.
+type UserProfileResponse struct {
+	Id       int             `json:"id"`
+	Name     *string         `json:"name,omitempty"`
+	Username *string         `json:"username,omitempty"`
+	Email    *string         `json:"email,omitempty"`
+	Address  *ProfileAddress `json:"address,omitempty"`
+	Phone    *string         `json:"phone,omitempty"`
+	Website  *string         `json:"website,omitempty"`
+	Company  *ProfileCompany `json:"company,omitempty"`
+}
+type ProfileAddress struct {
+	Street  string     `json:"street"`
+	Suite   string     `json:"suite,omitempty"`
+	City    string     `json:"city"`
+	Zipcode string     `json:"zipcode"`
+	Geo     ProfileGeo `json:"geo"`
+}
+type ProfileGeo struct {
+	Lat string `json:"lat"`
+	Lng string `json:"lng"`
+}
+type ProfileCompany struct {
+	Name        string `json:"name"`
+	CatchPhrase string `json:"catchPhrase,omitempty"`
+	Bs          string `json:"bs,omitempty"`
+}
+
+// profileFields are the sections of a UserProfileResponse that can be selected with the fields query parameter.
+var profileFields = []string{"name", "username", "email", "address", "phone", "website", "company"}
+
+// PostResponse is the post returned by the write operations on posts.
+type PostResponse struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"userId"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+// TodoSummary is the task progress of a user.
+type TodoSummary struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Open      int `json:"open"`
+}
+type UserTodo struct {
+	Id        int    `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+type PostComment struct {
 	Id    int    `json:"id"`
-	Title string `json:"title"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
 	Body  string `json:"body"`
 }
+type UserAlbum struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+type AlbumPhoto struct {
+	Id           int    `json:"id"`
+	Title        string `json:"title"`
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnailUrl"`
+}
+
+// BatchUserPostsRequest is the body of a batch user-posts lookup.
+type BatchUserPostsRequest struct {
+	Ids []int `json:"ids"`
+}
+
+// BatchUserPostsResponse holds the user-posts response of every user of a batch that could be fetched,
+// and the error of every user that could not, both keyed by user id.
+type BatchUserPostsResponse struct {
+	Results map[string]UserInfoResponse `json:"results"`
+	Errors  map[string]BatchError       `json:"errors"`
+}
+
+// BatchError is the reason a single user of a batch could not be fetched.
+type BatchError struct {
+	StatusCode int    `json:"statusCode"`
+	Msg        string `json:"msg"`
+}
 
 // ServerErrorResponse is the error server response. It returns the reason, http status code,
 // and request url for the response.
@@ -52,23 +175,47 @@ func NewServerErrorResponse(err error, requestUrl string, statusCode int) Server
 
 type Handler struct {
 	userClient user.Client
+	// cacheMaxAge is how long browsers and CDNs may cache the responses of the read handlers
+	cacheMaxAge time.Duration
 	logger zerolog.Logger
 }
 
-func NewHandler(client user.Client, logger zerolog.Logger) Handler {
+func NewHandler(client user.Client, cacheMaxAge time.Duration, logger zerolog.Logger) Handler {
 	return Handler{
 		userClient: client,
+		cacheMaxAge: cacheMaxAge,
 		logger: logger,
 	}
 }
 
 // GetUserPostsHandler receives a userId and calls the UserAPI to fetch a user info along with the
-// user's posts.
+// user's posts and a summary of the user's todos. Passing expand=comments nests the comments of each post
+// into the response. The posts are filtered with title_contains, sorted with sort=id|title and order, and
+// projected with fields=id,title,body.
 func(h Handler) GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "id")
+	opts, err := userPostsParams(r)
+	if err != nil {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
+	userInfoResp, err := h.userInfoResponse(r.Context(), userID, opts)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, userInfoResp); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// userInfoResponse fetches the user info, posts and todos of a user and combines them into a UserInfoResponse.
+func (h Handler) userInfoResponse(ctx context.Context, userID string, opts userPostsOptions) (UserInfoResponse, error) {
 	userInfo := make(chan user.User, 1)
 
-	g, ctx := errgroup.WithContext(r.Context())
+	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		defer close(userInfo)
 		u, err := h.userClient.GetUserInfo(ctx, userID)
@@ -87,11 +234,16 @@ func(h Handler) GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 	g.Go(func() error {
 		defer close(resp)
 		for u := range userInfo {
-			posts, err := h.userClient.GetUserPosts(ctx, strconv.Itoa(u.Id))
+			posts, err := h.userClient.GetUserPosts(ctx, strconv.Itoa(u.Id), opts.query)
 			if err != nil {
 				return err
 			}
-			res := toUserInfoResponse(u, posts)
+			res := toUserInfoResponse(u, posts, opts.fields)
+			if opts.expandComments {
+				if err = h.embedPostComments(ctx, res.Posts); err != nil {
+					return err
+				}
+			}
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -101,18 +253,338 @@ func(h Handler) GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 		return nil
 	})
 
+	// the todo summary is an add-on, a failure to fetch the todos is logged and the summary left out
+	todoSummary := make(chan *TodoSummary, 1)
+	g.Go(func() error {
+		defer close(todoSummary)
+		todos, err := h.userClient.GetUserTodos(ctx, userID, nil)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Warn().Err(err).Str("userId", userID).Msg("unable to fetch todos, omitting the todo summary")
+			}
+			return nil
+		}
+		summary := toTodoSummary(todos)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case todoSummary <- &summary:
+		}
+		return nil
+	})
+
 	if err := g.Wait(); err != nil {
+		return UserInfoResponse{}, err
+	}
+
+	userInfoResp := <-resp
+	userInfoResp.Todos = <-todoSummary
+	return userInfoResp, nil
+}
+
+// GetBatchUserPostsHandler fetches the user-posts response of many users in one call. The user ids are
+// read from the comma separated ids query parameter, or from a BatchUserPostsRequest body for a POST. The
+// users are fetched concurrently, with at most maxConcurrentBatchFetches in flight, and a failure for one
+// user is reported in the errors of the response instead of failing the whole batch.
+func (h Handler) GetBatchUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userIDs, err := batchUserIDParams(r)
+	if err != nil {
 		h.handleErrorResponse(err, w, r)
 		return
 	}
+	opts, err := userPostsParams(r)
+	if err != nil {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
 
-	userInfoResp := <-resp
-	if err := json.NewEncoder(w).Encode(userInfoResp); err != nil {
+	batchResp := BatchUserPostsResponse{
+		Results: make(map[string]UserInfoResponse, len(userIDs)),
+		Errors:  make(map[string]BatchError),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := semaphore.NewWeighted(maxConcurrentBatchFetches)
+	for _, userID := range userIDs {
+		if err = sem.Acquire(r.Context(), 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(userID string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			res, err := h.userInfoResponse(r.Context(), userID, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				batchResp.Errors[userID] = h.toBatchError(err)
+				return
+			}
+			batchResp.Results[userID] = res
+		}(userID)
+	}
+	wg.Wait()
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, batchResp); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// toBatchError converts the error of a single user in a batch into a BatchError, with the status code
+// handleErrorResponse would respond with.
+func (h Handler) toBatchError(err error) BatchError {
+	if statusCode, ok := clientErrorStatusCode(err); ok {
+		return BatchError{StatusCode: statusCode, Msg: err.Error()}
+	}
+	h.logger.Error().Err(err).Msg("internal server error in batch")
+	return BatchError{StatusCode: http.StatusInternalServerError, Msg: err.Error()}
+}
+
+// clientErrorStatusCode returns the status code of the response to an error of the client API, and false for
+// any other error.
+func clientErrorStatusCode(err error) (int, bool) {
+	var validationErr user.ValidationError
+	var circuitOpenErr user.CircuitOpenError
+	var rateLimitedErr user.RateLimitedError
+	var apiClientError user.APIClientError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest, true
+	case errors.As(err, &circuitOpenErr):
+		return http.StatusServiceUnavailable, true
+	case errors.As(err, &rateLimitedErr):
+		return http.StatusTooManyRequests, true
+	case errors.As(err, &apiClientError):
+		return apiClientError.StatusCode, true
+	}
+	return 0, false
+}
+
+// embedPostComments fetches the comments of every post concurrently, with at most
+// maxConcurrentCommentFetches in flight, and nests them into each UserPost.
+func (h Handler) embedPostComments(ctx context.Context, posts []UserPost) error {
+	sem := semaphore.NewWeighted(maxConcurrentCommentFetches)
+	g, ctx := errgroup.WithContext(ctx)
+	for i := range posts {
+		post := &posts[i]
+		if err := sem.Acquire(ctx, 1); err != nil {
+			// prefer the error of the fetch that cancelled the context
+			if werr := g.Wait(); werr != nil {
+				return werr
+			}
+			return err
+		}
+		g.Go(func() error {
+			defer sem.Release(1)
+			comments, err := h.userClient.GetPostComments(ctx, strconv.Itoa(post.Id))
+			if err != nil {
+				return err
+			}
+			post.Comments = toPostComments(comments)
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// GetPostCommentsHandler receives a postId and calls the Comments API to fetch the discussion thread
+// of the post.
+func (h Handler) GetPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	postID := chi.URLParam(r, "id")
+	comments, err := h.userClient.GetPostComments(r.Context(), postID)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, toPostComments(comments)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// GetUserProfileHandler receives a userId and calls the UserAPI to fetch the full profile of the user. The
+// optional comma separated fields query parameter selects the sections of the profile that are returned.
+func (h Handler) GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	fields, err := profileFieldParams(r)
+	if err != nil {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
+
+	u, err := h.userClient.GetUserInfo(r.Context(), userID)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, toUserProfileResponse(u, fields)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// ListUsersHandler calls the UserAPI to fetch a page of users selected by the page, limit, sort and order
+// query parameters. The response carries the total number of users in the X-Total-Count header and RFC 8288
+// Link headers to the first, previous, next and last pages.
+func (h Handler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptionParams(r)
+	if err != nil {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
+	fields, err := profileFieldParams(r)
+	if err != nil {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
+
+	list, err := h.userClient.ListUsers(r.Context(), opts)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	profiles := make([]UserProfileResponse, 0, len(list.Users))
+	for _, u := range list.Users {
+		profiles = append(profiles, toUserProfileResponse(u, fields))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(list.Total))
+	w.Header().Set("Link", paginationLinks(r.URL, opts, list.Total))
+	if err = h.writeCacheableJSON(w, r, profiles); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// GetUserAlbumsHandler receives a userId and calls the Albums API to fetch the user's albums.
+func (h Handler) GetUserAlbumsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	albums, err := h.userClient.GetUserAlbums(r.Context(), userID)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, toUserAlbums(albums)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// GetAlbumPhotosHandler receives an albumId and calls the Photos API to fetch the photos of the album.
+func (h Handler) GetAlbumPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	albumID := chi.URLParam(r, "id")
+	photos, err := h.userClient.GetAlbumPhotos(r.Context(), albumID)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, toAlbumPhotos(photos)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// GetUserTodosHandler receives a userId and calls the Todos API to fetch the user's todos. The optional
+// completed=true|false query parameter filters the todos by completion state.
+func (h Handler) GetUserTodosHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	var completed *bool
+	if c := r.URL.Query().Get("completed"); c != "" {
+		b, err := strconv.ParseBool(c)
+		if err != nil {
+			err = errors.Errorf("invalid completed value %q, expected true or false", c)
+			h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+			return
+		}
+		completed = &b
+	}
+
+	todos, err := h.userClient.GetUserTodos(r.Context(), userID, completed)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, toUserTodos(todos)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// CreatePostHandler validates the post in the request body and creates it through the Posts API.
+func (h Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
+	var in user.PostInput
+	if err := decodeRequestBody(r, &in); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	post, err := h.userClient.CreatePost(r.Context(), in)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(toPostResponse(post)); err != nil {
+		h.logger.Error().Err(err).Msg("unable to encode PostResponse to JSON")
+	}
+}
+
+// UpdatePostHandler validates the post in the request body and replaces the post with it through the
+// Posts API.
+func (h Handler) UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
+	var in user.PostInput
+	if err := decodeRequestBody(r, &in); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	post, err := h.userClient.UpdatePost(r.Context(), chi.URLParam(r, "id"), in)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(toPostResponse(post)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// PatchPostHandler validates the partial post in the request body and applies it to the post through
+// the Posts API.
+func (h Handler) PatchPostHandler(w http.ResponseWriter, r *http.Request) {
+	var patch user.PostPatch
+	if err := decodeRequestBody(r, &patch); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	post, err := h.userClient.PatchPost(r.Context(), chi.URLParam(r, "id"), patch)
+	if err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(toPostResponse(post)); err != nil {
 		h.handleErrorResponse(err, w, r)
 		return
 	}
 }
 
+// DeletePostHandler deletes a post through the Posts API.
+func (h Handler) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.userClient.DeletePost(r.Context(), chi.URLParam(r, "id")); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // MiddlewareLogger is a http interceptor and logs each request that comes in and determines the log level based on
 // the http status code that will be returned by the server.
 func (h Handler) MiddlewareLogger(next http.Handler) http.Handler {
@@ -151,9 +623,31 @@ func (h Handler) MiddlewareLogger(next http.Handler) http.Handler {
 }
 
 // handleErrorResponse logs and returns the appropriate http response code and response for errors from
-// the client API or from an actual internal server error.
+// the client API, for a ServerErrorResponse raised by a handler, or from an actual internal server error.
 func (h Handler) handleErrorResponse(err error, w http.ResponseWriter, r *http.Request) {
+	var serverErrorResp ServerErrorResponse
+	if ok := errors.As(err, &serverErrorResp); ok {
+		w.WriteHeader(serverErrorResp.StatusCode)
+		if err = json.NewEncoder(w).Encode(&serverErrorResp); err != nil {
+			h.logger.Error().Err(err).Msg("unable to encode ServerErrorResponse to JSON")
+			http.Error(w, "unable to encode ServerErrorResponse to JSON", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var circuitOpenErr user.CircuitOpenError
+	var rateLimitedErr user.RateLimitedError
+	switch {
+	case errors.As(err, &circuitOpenErr):
+		setRetryAfter(w, circuitOpenErr.RetryAfter)
+	case errors.As(err, &rateLimitedErr):
+		setRetryAfter(w, rateLimitedErr.RetryAfter)
+	}
 	var apiClientError user.APIClientError
+	if statusCode, ok := clientErrorStatusCode(err); ok && !errors.As(err, &apiClientError) {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), statusCode), w, r)
+		return
+	}
 	if ok := errors.As(err,&apiClientError); ok {
 		if apiClientError.StatusCode >= http.StatusInternalServerError {
 			h.logger.Error().
@@ -169,7 +663,7 @@ func (h Handler) handleErrorResponse(err error, w http.ResponseWriter, r *http.R
 		}
 		return
 	}
-	serverErrorResp := NewServerErrorResponse(err, r.URL.String(), http.StatusInternalServerError)
+	serverErrorResp = NewServerErrorResponse(err, r.URL.String(), http.StatusInternalServerError)
 	h.logger.Error().Err(err).Msg("internal server error")
 	w.WriteHeader(serverErrorResp.StatusCode)
 	if err = json.NewEncoder(w).Encode(&serverErrorResp); err != nil {
@@ -179,8 +673,275 @@ func (h Handler) handleErrorResponse(err error, w http.ResponseWriter, r *http.R
 	}
 }
 
-// toUserInfoResponse combines all the user.Post into a user.User
-func toUserInfoResponse(user user.User, posts []user.Post) UserInfoResponse {
+// writeCacheableJSON writes v as the JSON response of a read handler. The response of a GET request carries a
+// strong ETag over the encoded body and a Cache-Control header derived from the cache max age, and is replaced
+// by a 304 Not Modified when the If-None-Match header of the request matches the ETag.
+func (h Handler) writeCacheableJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		sum := sha256.Sum256(buf.Bytes())
+		etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", h.cacheControl())
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// cacheControl lets shared caches keep a response for the cache max age, or requires them to revalidate it on
+// every use when there is none.
+func (h Handler) cacheControl() string {
+	if maxAge := int(h.cacheMaxAge.Seconds()); maxAge > 0 {
+		return fmt.Sprintf("public, max-age=%d", maxAge)
+	}
+	return "no-cache"
+}
+
+// setRetryAfter sets the Retry-After header to the delay rounded up to whole seconds, if any.
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	if seconds := int(math.Ceil(delay.Seconds())); seconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+}
+
+// etagMatches reports whether the If-None-Match header lists the ETag, comparing weak ETags as strong ones.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRequestBody decodes the JSON request body into v. A malformed body is reported as a bad request.
+func decodeRequestBody(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		err = errors.Wrap(err, "invalid request body")
+		return NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// profileFieldParams returns the set of profile sections requested through the fields query parameter.
+// All sections are returned when the parameter is absent.
+func profileFieldParams(r *http.Request) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	q := r.URL.Query().Get("fields")
+	if q == "" {
+		for _, f := range profileFields {
+			fields[f] = true
+		}
+		return fields, nil
+	}
+	for _, f := range strings.Split(q, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !isProfileField(f) {
+			return nil, errors.Errorf("unknown field %q, expected any of %s", f, strings.Join(profileFields, ","))
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+func isProfileField(field string) bool {
+	for _, f := range profileFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// listOptionParams reads the page, limit, sort and order query parameters of a listing.
+func listOptionParams(r *http.Request) (user.ListOptions, error) {
+	q := r.URL.Query()
+	page, limit, err := pageParams(r)
+	if err != nil {
+		return user.ListOptions{}, err
+	}
+	if err = validatePage(page, limit); err != nil {
+		return user.ListOptions{}, err
+	}
+	opts := user.ListOptions{
+		Page:  page,
+		Limit: limit,
+		Sort:  q.Get("sort"),
+		Order: "asc",
+	}
+	if o := q.Get("order"); o != "" {
+		opts.Order = o
+	}
+	return opts, opts.Validate()
+}
+
+// pageParams reads the page and limit query parameters, defaulting to the first page of defaultListLimit
+// items. The range of the values is checked by validatePage.
+func pageParams(r *http.Request) (int, int, error) {
+	q := r.URL.Query()
+	page, limit := 1, defaultListLimit
+	if p := q.Get("page"); p != "" {
+		var err error
+		if page, err = strconv.Atoi(p); err != nil {
+			return 0, 0, errors.Errorf("invalid page %q, expected an integer", p)
+		}
+	}
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			return 0, 0, errors.Errorf("invalid limit %q, expected an integer", l)
+		}
+	}
+	return page, limit, nil
+}
+
+// validatePage returns an error if the page is not positive or the limit is not between 1 and MaxListLimit.
+func validatePage(page int, limit int) error {
+	if page < 1 {
+		return errors.Errorf("invalid page %d, expected a positive integer", page)
+	}
+	if limit < 1 || limit > user.MaxListLimit {
+		return errors.Errorf("invalid limit %d, expected between 1 and %d", limit, user.MaxListLimit)
+	}
+	return nil
+}
+
+// paginationLinks builds the RFC 8288 Link header value pointing to the first, previous, next and last
+// pages of a listing of total items.
+func paginationLinks(u *url.URL, opts user.ListOptions, total int) string {
+	lastPage := (total + opts.Limit - 1) / opts.Limit
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	pageURL := func(page int) string {
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		q.Set("limit", strconv.Itoa(opts.Limit))
+		return (&url.URL{Path: u.Path, RawQuery: q.Encode()}).String()
+	}
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(1))}
+	if opts.Page > 1 {
+		prev := opts.Page - 1
+		if prev > lastPage {
+			prev = lastPage
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(prev)))
+	}
+	if opts.Page < lastPage {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(opts.Page+1)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(lastPage)))
+	return strings.Join(links, ", ")
+}
+
+// batchUserIDParams reads the user ids of a batch lookup from the ids query parameter, or from the
+// BatchUserPostsRequest body of a POST. Duplicate ids are only returned once.
+func batchUserIDParams(r *http.Request) ([]string, error) {
+	var ids []string
+	if r.Method == http.MethodPost {
+		var batchReq BatchUserPostsRequest
+		if err := decodeRequestBody(r, &batchReq); err != nil {
+			return nil, err
+		}
+		for _, id := range batchReq.Ids {
+			ids = append(ids, strconv.Itoa(id))
+		}
+	} else {
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(ids))
+	userIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		err := errors.New("at least one user id is required")
+		return nil, NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest)
+	}
+	if len(userIDs) > maxBatchSize {
+		err := errors.Errorf("at most %d user ids can be requested at once", maxBatchSize)
+		return nil, NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest)
+	}
+	return userIDs, nil
+}
+
+// userPostsParams reads the expand, title_contains, sort, order and fields query parameters of the
+// user-posts routes.
+func userPostsParams(r *http.Request) (userPostsOptions, error) {
+	q := r.URL.Query()
+	opts := userPostsOptions{
+		expandComments: expandParams(r)["comments"],
+		query: user.PostQuery{
+			TitleContains: q.Get("title_contains"),
+			Sort:          q.Get("sort"),
+			Order:         q.Get("order"),
+		},
+	}
+	if err := opts.query.Validate(); err != nil {
+		return userPostsOptions{}, err
+	}
+
+	if q.Get("fields") == "" {
+		return opts, nil
+	}
+	opts.fields = make(map[string]bool)
+	for _, f := range strings.Split(q.Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if !isPostField(f) {
+			return userPostsOptions{}, errors.Errorf("unknown field %q, expected any of %s", f, strings.Join(postFields, ","))
+		}
+		opts.fields[f] = true
+	}
+	return opts, nil
+}
+
+func isPostField(field string) bool {
+	for _, f := range postFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// expandParams returns the set of resources requested through the comma separated expand query parameter.
+func expandParams(r *http.Request) map[string]bool {
+	expand := make(map[string]bool)
+	for _, e := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			expand[e] = true
+		}
+	}
+	return expand
+}
+
+// toUserInfoResponse combines all the user.Post into a user.User, keeping the requested fields of the posts, or
+// every field when fields is nil.
+func toUserInfoResponse(user user.User, posts []user.Post, fields map[string]bool) UserInfoResponse {
 	userInfoResp := UserInfoResponse{
 		Id: user.Id,
 		UserInfo: UserInfo {
@@ -191,13 +952,133 @@ func toUserInfoResponse(user user.User, posts []user.Post) UserInfoResponse {
 	}
 	userPosts := make([]UserPost, 0, len(posts))
 	for _, p := range posts {
+		p := p
 		post := UserPost {
 			Id: p.Id,
-			Title: p.Title,
-			Body: p.Body,
+		}
+		if fields == nil || fields["title"] {
+			post.Title = &p.Title
+		}
+		if fields == nil || fields["body"] {
+			post.Body = &p.Body
 		}
 		userPosts = append(userPosts, post)
 	}
 	userInfoResp.Posts = userPosts
 	return userInfoResp
 }
+
+// toPostComments converts the user.Comment from the Comments API into a PostComment response
+func toPostComments(comments []user.Comment) []PostComment {
+	postComments := make([]PostComment, 0, len(comments))
+	for _, c := range comments {
+		postComments = append(postComments, PostComment{
+			Id:    c.Id,
+			Name:  c.Name,
+			Email: c.Email,
+			Body:  c.Body,
+		})
+	}
+	return postComments
+}
+
+// toUserAlbums converts the user.Album from the Albums API into a UserAlbum response
+func toUserAlbums(albums []user.Album) []UserAlbum {
+	userAlbums := make([]UserAlbum, 0, len(albums))
+	for _, a := range albums {
+		userAlbums = append(userAlbums, UserAlbum{
+			Id:    a.Id,
+			Title: a.Title,
+		})
+	}
+	return userAlbums
+}
+
+// toAlbumPhotos converts the user.Photo from the Photos API into an AlbumPhoto response
+func toAlbumPhotos(photos []user.Photo) []AlbumPhoto {
+	albumPhotos := make([]AlbumPhoto, 0, len(photos))
+	for _, p := range photos {
+		albumPhotos = append(albumPhotos, AlbumPhoto{
+			Id:           p.Id,
+			Title:        p.Title,
+			Url:          p.Url,
+			ThumbnailUrl: p.ThumbnailUrl,
+		})
+	}
+	return albumPhotos
+}
+
+// toTodoSummary counts the completed and open todos of a user
+func toTodoSummary(todos []user.Todo) TodoSummary {
+	summary := TodoSummary{Total: len(todos)}
+	for _, t := range todos {
+		if t.Completed {
+			summary.Completed++
+		}
+	}
+	summary.Open = summary.Total - summary.Completed
+	return summary
+}
+
+// toUserTodos converts the user.Todo from the Todos API into a UserTodo response
+func toUserTodos(todos []user.Todo) []UserTodo {
+	userTodos := make([]UserTodo, 0, len(todos))
+	for _, t := range todos {
+		userTodos = append(userTodos, UserTodo{
+			Id:        t.Id,
+			Title:     t.Title,
+			Completed: t.Completed,
+		})
+	}
+	return userTodos
+}
+
+// toPostResponse converts a user.Post returned by a write operation into a PostResponse
+func toPostResponse(post user.Post) PostResponse {
+	return PostResponse{
+		Id:     post.Id,
+		UserId: post.UserId,
+		Title:  post.Title,
+		Body:   post.Body,
+	}
+}
+
+// toUserProfileResponse converts a user.User into a UserProfileResponse containing only the requested fields
+func toUserProfileResponse(u user.User, fields map[string]bool) UserProfileResponse {
+	profile := UserProfileResponse{Id: u.Id}
+	if fields["name"] {
+		profile.Name = &u.Name
+	}
+	if fields["username"] {
+		profile.Username = &u.Username
+	}
+	if fields["email"] {
+		profile.Email = &u.Email
+	}
+	if fields["address"] {
+		profile.Address = &ProfileAddress{
+			Street:  u.Address.Street,
+			Suite:   u.Address.Suite,
+			City:    u.Address.City,
+			Zipcode: u.Address.Zipcode,
+			Geo: ProfileGeo{
+				Lat: u.Address.Geo.Lat,
+				Lng: u.Address.Geo.Lng,
+			},
+		}
+	}
+	if fields["phone"] {
+		profile.Phone = &u.Phone
+	}
+	if fields["website"] {
+		profile.Website = &u.Website
+	}
+	if fields["company"] {
+		profile.Company = &ProfileCompany{
+			Name:        u.Company.Name,
+			CatchPhrase: u.Company.CatchPhrase,
+			Bs:          u.Company.Bs,
+		}
+	}
+	return profile
+}
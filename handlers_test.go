@@ -13,7 +13,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetUserPostsHandler(t *testing.T) {
@@ -43,6 +46,20 @@ func TestGetUserPostsHandler(t *testing.T) {
 		},
 	}
 
+	todos := []user.Todo{
+		{
+			UserId: 1,
+			Id: 1,
+			Title: "my first todo",
+			Completed: true,
+		},
+		{
+			UserId: 1,
+			Id: 2,
+			Title: "my second todo",
+		},
+	}
+
 	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
 		return true
 	})
@@ -50,27 +67,143 @@ func TestGetUserPostsHandler(t *testing.T) {
 	t.Run("successful response", func(t *testing.T) {
 		mockClient := new(MockUserClient)
 		logger := zerolog.New(io.Discard)
-		handler := NewHandler(mockClient, logger)
+		handler := NewHandler(mockClient, 0, logger)
 
 		recorder := httptest.NewRecorder()
 		recorder.WriteHeader(http.StatusOK)
 
 		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
-		mockClient.On("GetUserPosts", mockContext, "1").Return(posts, nil)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
+		mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return(posts, nil)
 
 		handler.GetUserPostsHandler(recorder, req)
-		expectedResult := toUserInfoResponse(u, posts)
+		expectedResult := toUserInfoResponse(u, posts, nil)
+		expectedResult.Todos = &TodoSummary{Total: 2, Completed: 1, Open: 1}
+		var result UserInfoResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, expectedResult, result)
+	})
+
+	t.Run("successful response with expanded comments", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		logger := zerolog.New(io.Discard)
+		handler := NewHandler(mockClient, 0, logger)
+
+		recorder := httptest.NewRecorder()
+		expandReq := req.Clone(req.Context())
+		expandReq.URL.RawQuery = "expand=comments"
+
+		comments := []user.Comment{
+			{
+				PostId: 1,
+				Id: 1,
+				Name: "a comment",
+				Email: "commenter@example.com",
+				Body: "a comment body",
+			},
+		}
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
+		mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return(posts, nil)
+		mockClient.On("GetPostComments", mockContext, "1").Return(comments, nil)
+		mockClient.On("GetPostComments", mockContext, "2").Return([]user.Comment{}, nil)
+
+		handler.GetUserPostsHandler(recorder, expandReq)
+		expectedResult := toUserInfoResponse(u, posts, nil)
+		todoSummary := toTodoSummary(todos)
+		expectedResult.Todos = &todoSummary
+		expectedResult.Posts[0].Comments = toPostComments(comments)
 		var result UserInfoResponse
 		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
 			t.Error(err)
 		}
 		assert.Equal(t, expectedResult, result)
+		mockClient.AssertNumberOfCalls(t, "GetPostComments", 2)
+	})
+
+	t.Run("getPostComments failure with expanded comments", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		logger := zerolog.New(io.Discard)
+		handler := NewHandler(mockClient, 0, logger)
+
+		recorder := httptest.NewRecorder()
+		expandReq := req.Clone(req.Context())
+		expandReq.URL.RawQuery = "expand=comments"
+
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
+		mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return(posts, nil)
+		mockClient.On("GetPostComments", mockContext, mock.Anything).Return([]user.Comment{}, errors.New("comments unavailable"))
+
+		handler.GetUserPostsHandler(recorder, expandReq)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+
+	t.Run("getUserTodos failure omits the todo summary", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+
+		recorder := httptest.NewRecorder()
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return([]user.Todo{}, errors.New("todos unavailable"))
+		mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return(posts, nil)
+
+		handler.GetUserPostsHandler(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var result map[string]interface{}
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.NotContains(t, result, "todos")
+		assert.Len(t, result["posts"], 2)
+	})
+
+	t.Run("successful response with filtered, sorted and projected posts", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+
+		recorder := httptest.NewRecorder()
+		queryReq := req.Clone(req.Context())
+		queryReq.URL.RawQuery = "title_contains=title&sort=title&order=desc&fields=id,title"
+
+		q := user.PostQuery{TitleContains: "title", Sort: "title", Order: "desc"}
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
+		mockClient.On("GetUserPosts", mockContext, "1", q).Return([]user.Post{posts[1], posts[0]}, nil)
+
+		handler.GetUserPostsHandler(recorder, queryReq)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var result map[string]interface{}
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"id": float64(2), "title": "my second title"},
+			map[string]interface{}{"id": float64(1), "title": "my first title"},
+		}, result["posts"])
+	})
+
+	t.Run("invalid post query", func(t *testing.T) {
+		for _, query := range []string{"sort=body", "order=up", "fields=id,author"} {
+			mockClient := new(MockUserClient)
+			handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+
+			recorder := httptest.NewRecorder()
+			queryReq := req.Clone(req.Context())
+			queryReq.URL.RawQuery = query
+
+			handler.GetUserPostsHandler(recorder, queryReq)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+			mockClient.AssertNotCalled(t, "GetUserInfo")
+		}
 	})
 
 	t.Run("getUserInfo failure", func(t *testing.T) {
 		mockClient := new(MockUserClient)
 		logger := zerolog.New(io.Discard)
-		handler := NewHandler(mockClient, logger)
+		handler := NewHandler(mockClient, 0, logger)
 
 		recorder := httptest.NewRecorder()
 		recorder.WriteHeader(http.StatusNotFound)
@@ -78,6 +211,7 @@ func TestGetUserPostsHandler(t *testing.T) {
 
 		err := user.NewAPIClientError(resp, req)
 		mockClient.On("GetUserInfo", mockContext, "1").Return(user.User{}, err)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
 
 		handler.GetUserPostsHandler(recorder, req)
 		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
@@ -89,7 +223,7 @@ func TestGetUserPostsHandler(t *testing.T) {
 	t.Run("getUserPosts failure", func(t *testing.T) {
 		mockClient := new(MockUserClient)
 		logger := zerolog.New(io.Discard)
-		handler := NewHandler(mockClient, logger)
+		handler := NewHandler(mockClient, 0, logger)
 
 		recorder := httptest.NewRecorder()
 		recorder.WriteHeader(http.StatusNotFound)
@@ -97,7 +231,8 @@ func TestGetUserPostsHandler(t *testing.T) {
 
 		err := user.NewAPIClientError(resp, req)
 		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
-		mockClient.On("GetUserPosts", mockContext, "1").Return([]user.Post{}, err)
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
+		mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return([]user.Post{}, err)
 
 		handler.GetUserPostsHandler(recorder, req)
 		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
@@ -107,6 +242,603 @@ func TestGetUserPostsHandler(t *testing.T) {
 	})
 }
 
+func TestGetBatchUserPostsHandler(t *testing.T) {
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+	u := user.User{Id: 1, Name: "my first name", Username: "this_username", Email: "first@example.com"}
+	posts := []user.Post{{UserId: 1, Id: 1, Title: "my first title", Body: "my first body"}}
+	newMockClient := func() *MockUserClient {
+		notFound := httptest.NewRecorder()
+		notFound.WriteHeader(http.StatusNotFound)
+		notFoundErr := user.NewAPIClientError(notFound.Result(), httptest.NewRequest(http.MethodGet, "/users/2", nil))
+
+		mockClient := new(MockUserClient)
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+		mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return(posts, nil)
+		mockClient.On("GetUserInfo", mockContext, "2").Return(user.User{}, notFoundErr)
+		mockClient.On("GetUserTodos", mockContext, mock.Anything, (*bool)(nil)).Return([]user.Todo{}, nil)
+		return mockClient
+	}
+	expectedResult := toUserInfoResponse(u, posts, nil)
+	expectedResult.Todos = &TodoSummary{}
+	expectedResponse := BatchUserPostsResponse{
+		Results: map[string]UserInfoResponse{
+			"1": expectedResult,
+		},
+		Errors: map[string]BatchError{
+			"2": {StatusCode: http.StatusNotFound, Msg: "API response error statusCode=404 body= url=/users/2"},
+		},
+	}
+
+	t.Run("ids query parameter", func(t *testing.T) {
+		mockClient := newMockClient()
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		handler.GetBatchUserPostsHandler(recorder, httptest.NewRequest(http.MethodGet, "/v1/user-posts?ids=1,2,1", nil))
+		var result BatchUserPostsResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, expectedResponse, result)
+		mockClient.AssertNumberOfCalls(t, "GetUserInfo", 2)
+	})
+
+	t.Run("request body", func(t *testing.T) {
+		mockClient := newMockClient()
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/user-posts", strings.NewReader(`{"ids":[1,2]}`))
+		handler.GetBatchUserPostsHandler(recorder, req)
+		var result BatchUserPostsResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, expectedResponse, result)
+	})
+
+	t.Run("throttled ids", func(t *testing.T) {
+		rateLimitedErr := user.RateLimitedError{RetryAfter: time.Second}
+		circuitOpenErr := user.CircuitOpenError{RetryAfter: time.Minute}
+		mockClient := new(MockUserClient)
+		mockClient.On("GetUserInfo", mockContext, "3").Return(user.User{}, rateLimitedErr)
+		mockClient.On("GetUserInfo", mockContext, "4").Return(user.User{}, circuitOpenErr)
+		mockClient.On("GetUserPosts", mockContext, mock.Anything, user.PostQuery{}).Return(posts, nil)
+		mockClient.On("GetUserTodos", mockContext, mock.Anything, (*bool)(nil)).Return([]user.Todo{}, nil)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		handler.GetBatchUserPostsHandler(recorder, httptest.NewRequest(http.MethodGet, "/v1/user-posts?ids=3,4", nil))
+		var result BatchUserPostsResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, map[string]BatchError{
+			"3": {StatusCode: http.StatusTooManyRequests, Msg: rateLimitedErr.Error()},
+			"4": {StatusCode: http.StatusServiceUnavailable, Msg: circuitOpenErr.Error()},
+		}, result.Errors)
+	})
+
+	t.Run("no ids", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		handler.GetBatchUserPostsHandler(recorder, httptest.NewRequest(http.MethodGet, "/v1/user-posts", nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("too many ids", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		ids := make([]string, 0, maxBatchSize+1)
+		for i := 0; i <= maxBatchSize; i++ {
+			ids = append(ids, strconv.Itoa(i+1))
+		}
+		target := "/v1/user-posts?ids=" + strings.Join(ids, ",")
+		handler.GetBatchUserPostsHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockClient.AssertNotCalled(t, "GetUserInfo")
+	})
+}
+
+func TestGetPostCommentsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/posts/1/comments", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	comments := []user.Comment{
+		{
+			PostId: 1,
+			Id: 1,
+			Name: "first comment",
+			Email: "first@example.com",
+			Body: "first comment body",
+		},
+		{
+			PostId: 1,
+			Id: 2,
+			Name: "second comment",
+			Email: "second@example.com",
+			Body: "second comment body",
+		},
+	}
+
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+
+	t.Run("successful response", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("GetPostComments", mockContext, "1").Return(comments, nil)
+
+		handler.GetPostCommentsHandler(recorder, req)
+		var result []PostComment
+		if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, toPostComments(comments), result)
+	})
+
+	t.Run("getPostComments failure", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+
+		recorder := httptest.NewRecorder()
+		recorder.WriteHeader(http.StatusNotFound)
+		resp := recorder.Result()
+
+		err := user.NewAPIClientError(resp, req)
+		mockClient.On("GetPostComments", mockContext, "1").Return([]user.Comment{}, err)
+
+		handler.GetPostCommentsHandler(recorder, req)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.JSONEq(t,
+			`{"statusCode":404,"msg":"API returned an invalid or empty response","url":"/v1/posts/1/comments"}`,
+			recorder.Body.String())
+	})
+}
+
+func TestGetUserAlbumsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/1/albums", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+
+	t.Run("successful response", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		albums := []user.Album{{UserId: 1, Id: 3, Title: "Summer"}}
+		mockClient.On("GetUserAlbums", mockContext, "1").Return(albums, nil)
+
+		handler.GetUserAlbumsHandler(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `[{"id":3,"title":"Summer"}]`, recorder.Body.String())
+	})
+
+	t.Run("getUserAlbums failure", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("GetUserAlbums", mockContext, "1").Return([]user.Album{}, errors.New("albums unavailable"))
+
+		handler.GetUserAlbumsHandler(recorder, req)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+}
+
+func TestConditionalRequests(t *testing.T) {
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+	mockClient := new(MockUserClient)
+	mockClient.On("GetUserAlbums", mockContext, "1").Return([]user.Album{{UserId: 1, Id: 3, Title: "Summer"}}, nil)
+	mockClient.On("GetUserInfo", mockContext, "1").Return(user.User{Id: 1, Name: "my first name"}, nil)
+	mockClient.On("GetUserPosts", mockContext, "1", user.PostQuery{}).Return([]user.Post{{UserId: 1, Id: 1, Title: "my first title"}}, nil)
+	mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return([]user.Todo{}, nil)
+	handler := NewHandler(mockClient, 5*time.Minute, zerolog.New(io.Discard))
+	serve := func(handlerFunc func(Handler) http.HandlerFunc, target string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		recorder := httptest.NewRecorder()
+		handlerFunc(handler)(recorder, req)
+		return recorder
+	}
+
+	for target, handlerFunc := range map[string]func(Handler) http.HandlerFunc{
+		"/v1/users/1/albums": func(h Handler) http.HandlerFunc { return h.GetUserAlbumsHandler },
+		"/v1/user-posts/1":   func(h Handler) http.HandlerFunc { return h.GetUserPostsHandler },
+	} {
+		t.Run(target, func(t *testing.T) {
+			first := serve(handlerFunc, target, "")
+			etag := first.Header().Get("ETag")
+			assert.Equal(t, http.StatusOK, first.Code)
+			assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+			assert.Equal(t, "public, max-age=300", first.Header().Get("Cache-Control"))
+			assert.Equal(t, etag, serve(handlerFunc, target, "").Header().Get("ETag"))
+
+			for _, ifNoneMatch := range []string{etag, `"other", W/` + etag, "*"} {
+				recorder := serve(handlerFunc, target, ifNoneMatch)
+				assert.Equal(t, http.StatusNotModified, recorder.Code, ifNoneMatch)
+				assert.Empty(t, recorder.Body.String())
+				assert.Equal(t, etag, recorder.Header().Get("ETag"))
+			}
+			assert.Equal(t, http.StatusOK, serve(handlerFunc, target, `"other"`).Code)
+		})
+	}
+
+	handler = NewHandler(mockClient, 0, zerolog.New(io.Discard))
+	assert.Equal(t, "no-cache", serve(func(h Handler) http.HandlerFunc { return h.GetUserAlbumsHandler }, "/v1/users/1/albums", "").Header().Get("Cache-Control"))
+}
+
+func TestGetAlbumPhotosHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/albums/3/photos", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "3")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+
+	t.Run("successful response", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		photos := []user.Photo{{AlbumId: 3, Id: 7, Title: "Beach", Url: "https://example.com/7", ThumbnailUrl: "https://example.com/7/thumb"}}
+		mockClient.On("GetAlbumPhotos", mockContext, "3").Return(photos, nil)
+
+		handler.GetAlbumPhotosHandler(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t,
+			`[{"id":7,"title":"Beach","url":"https://example.com/7","thumbnailUrl":"https://example.com/7/thumb"}]`,
+			recorder.Body.String())
+	})
+
+	t.Run("getAlbumPhotos failure", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+
+		recorder := httptest.NewRecorder()
+		recorder.WriteHeader(http.StatusNotFound)
+		resp := recorder.Result()
+
+		err := user.NewAPIClientError(resp, req)
+		mockClient.On("GetAlbumPhotos", mockContext, "3").Return([]user.Photo{}, err)
+
+		handler.GetAlbumPhotosHandler(recorder, req)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestGetUserTodosHandler(t *testing.T) {
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+	newRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	todos := []user.Todo{{UserId: 1, Id: 4, Title: "water plants", Completed: true}}
+
+	t.Run("all todos", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("GetUserTodos", mockContext, "1", (*bool)(nil)).Return(todos, nil)
+
+		handler.GetUserTodosHandler(recorder, newRequest("/v1/users/1/todos"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `[{"id":4,"title":"water plants","completed":true}]`, recorder.Body.String())
+	})
+
+	t.Run("completed filter", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		completed := mock.MatchedBy(func(c *bool) bool {
+			return c != nil && *c
+		})
+		mockClient.On("GetUserTodos", mockContext, "1", completed).Return(todos, nil)
+
+		handler.GetUserTodosHandler(recorder, newRequest("/v1/users/1/todos?completed=true"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("invalid completed filter", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		handler.GetUserTodosHandler(recorder, newRequest("/v1/users/1/todos?completed=maybe"))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.JSONEq(t,
+			`{"statusCode":400,"requestUrl":"/v1/users/1/todos?completed=maybe","msg":"invalid completed value \"maybe\", expected true or false"}`,
+			recorder.Body.String())
+		mockClient.AssertNotCalled(t, "GetUserTodos")
+	})
+}
+
+func TestToTodoSummary(t *testing.T) {
+	todos := []user.Todo{
+		{Id: 1, Completed: true},
+		{Id: 2, Completed: false},
+		{Id: 3, Completed: false},
+	}
+	assert.Equal(t, TodoSummary{Total: 3, Completed: 1, Open: 2}, toTodoSummary(todos))
+	assert.Equal(t, TodoSummary{}, toTodoSummary(nil))
+}
+
+func TestPostWriteHandlers(t *testing.T) {
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+	newRequest := func(method string, target string, body string, postID string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		if postID != "" {
+			rctx.URLParams.Add("id", postID)
+		}
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	post := user.Post{UserId: 1, Id: 101, Title: "a title", Body: "a body"}
+
+	t.Run("create post", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		in := user.PostInput{UserId: 1, Title: "a title", Body: "a body"}
+		mockClient.On("CreatePost", mockContext, in).Return(post, nil)
+
+		handler.CreatePostHandler(recorder, newRequest(http.MethodPost, "/v1/posts",
+			`{"userId":1,"title":"a title","body":"a body"}`, ""))
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.JSONEq(t, `{"id":101,"userId":1,"title":"a title","body":"a body"}`, recorder.Body.String())
+	})
+
+	t.Run("create post with malformed body", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		handler.CreatePostHandler(recorder, newRequest(http.MethodPost, "/v1/posts", `{"userId":"one"}`, ""))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockClient.AssertNotCalled(t, "CreatePost")
+	})
+
+	t.Run("create post with invalid post", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		in := user.PostInput{UserId: 1, Body: "a body"}
+		mockClient.On("CreatePost", mockContext, in).
+			Return(user.Post{}, user.ValidationError{Field: "title", Msg: "must not be empty"})
+
+		handler.CreatePostHandler(recorder, newRequest(http.MethodPost, "/v1/posts", `{"userId":1,"body":"a body"}`, ""))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.JSONEq(t, `{"statusCode":400,"requestUrl":"/v1/posts","msg":"title must not be empty"}`, recorder.Body.String())
+	})
+
+	t.Run("update post", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		in := user.PostInput{UserId: 1, Title: "a title", Body: "a body"}
+		mockClient.On("UpdatePost", mockContext, "101", in).Return(post, nil)
+
+		handler.UpdatePostHandler(recorder, newRequest(http.MethodPut, "/v1/posts/101",
+			`{"userId":1,"title":"a title","body":"a body"}`, "101"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":101,"userId":1,"title":"a title","body":"a body"}`, recorder.Body.String())
+	})
+
+	t.Run("patch post", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		title := mock.MatchedBy(func(p user.PostPatch) bool {
+			return p.Title != nil && *p.Title == "a title" && p.Body == nil && p.UserId == nil
+		})
+		mockClient.On("PatchPost", mockContext, "101", title).Return(post, nil)
+
+		handler.PatchPostHandler(recorder, newRequest(http.MethodPatch, "/v1/posts/101", `{"title":"a title"}`, "101"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("delete post", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("DeletePost", mockContext, "101").Return(nil)
+
+		handler.DeletePostHandler(recorder, newRequest(http.MethodDelete, "/v1/posts/101", "", "101"))
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+	})
+}
+
+func TestGetUserProfileHandler(t *testing.T) {
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+	newRequest := func(target string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	u := user.User{
+		Id: 1,
+		Name: "Bob Loblaw",
+		Username: "bob",
+		Email: "bob@lawyer.com",
+		Phone: "123-456-1234",
+		Website: "www.bob.com",
+	}
+	u.Address.Street = "Main St"
+	u.Address.City = "Springfield"
+	u.Address.Zipcode = "12345"
+	u.Address.Geo.Lat = "-37.3159"
+	u.Address.Geo.Lng = "81.1496"
+	u.Company.Name = "Bob Loblaw Law"
+
+	t.Run("full profile", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+
+		handler.GetUserProfileHandler(recorder, newRequest("/v1/users/1"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{
+			"id":1,
+			"name":"Bob Loblaw",
+			"username":"bob",
+			"email":"bob@lawyer.com",
+			"address":{"street":"Main St","city":"Springfield","zipcode":"12345","geo":{"lat":"-37.3159","lng":"81.1496"}},
+			"phone":"123-456-1234",
+			"website":"www.bob.com",
+			"company":{"name":"Bob Loblaw Law"}
+		}`, recorder.Body.String())
+	})
+
+	t.Run("sparse fieldset", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("GetUserInfo", mockContext, "1").Return(u, nil)
+
+		handler.GetUserProfileHandler(recorder, newRequest("/v1/users/1?fields=name,company"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":1,"name":"Bob Loblaw","company":{"name":"Bob Loblaw Law"}}`, recorder.Body.String())
+	})
+
+	t.Run("requested empty fields are kept", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		mockClient.On("GetUserInfo", mockContext, "1").Return(user.User{Id: 1, Name: "Bob Loblaw"}, nil)
+
+		handler.GetUserProfileHandler(recorder, newRequest("/v1/users/1?fields=name,phone,website"))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"id":1,"name":"Bob Loblaw","phone":"","website":""}`, recorder.Body.String())
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		handler.GetUserProfileHandler(recorder, newRequest("/v1/users/1?fields=name,password"))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockClient.AssertNotCalled(t, "GetUserInfo")
+	})
+}
+
+func TestListUsersHandler(t *testing.T) {
+	mockContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return true
+	})
+	list := user.UserList{
+		Users: []user.User{
+			{Id: 3, Name: "Clementine Bauch", Username: "Samantha", Email: "Nathan@yesenia.net"},
+			{Id: 4, Name: "Patricia Lebsack", Username: "Karianne", Email: "Julianne.OConner@kory.org"},
+		},
+		Total: 10,
+	}
+
+	t.Run("successful response", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		opts := user.ListOptions{Page: 2, Limit: 2, Sort: "name", Order: "desc"}
+		mockClient.On("ListUsers", mockContext, opts).Return(list, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/users?page=2&limit=2&sort=name&order=desc&fields=name", nil)
+		handler.ListUsersHandler(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `[{"id":3,"name":"Clementine Bauch"},{"id":4,"name":"Patricia Lebsack"}]`, recorder.Body.String())
+		assert.Equal(t, "10", recorder.Header().Get("X-Total-Count"))
+		assert.Equal(t,
+			`</v1/users?fields=name&limit=2&order=desc&page=1&sort=name>; rel="first", `+
+				`</v1/users?fields=name&limit=2&order=desc&page=1&sort=name>; rel="prev", `+
+				`</v1/users?fields=name&limit=2&order=desc&page=3&sort=name>; rel="next", `+
+				`</v1/users?fields=name&limit=2&order=desc&page=5&sort=name>; rel="last"`,
+			recorder.Header().Get("Link"))
+	})
+
+	t.Run("default options", func(t *testing.T) {
+		mockClient := new(MockUserClient)
+		handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+		recorder := httptest.NewRecorder()
+
+		opts := user.ListOptions{Page: 1, Limit: defaultListLimit, Order: "asc"}
+		mockClient.On("ListUsers", mockContext, opts).Return(list, nil)
+
+		handler.ListUsersHandler(recorder, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, `</v1/users?limit=10&page=1>; rel="first", </v1/users?limit=10&page=1>; rel="last"`,
+			recorder.Header().Get("Link"))
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		for _, target := range []string{
+			"/v1/users?page=first",
+			"/v1/users?page=0",
+			"/v1/users?limit=1000",
+			"/v1/users?sort=password",
+			"/v1/users?order=sideways",
+		} {
+			mockClient := new(MockUserClient)
+			handler := NewHandler(mockClient, 0, zerolog.New(io.Discard))
+			recorder := httptest.NewRecorder()
+
+			handler.ListUsersHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, target)
+			mockClient.AssertNotCalled(t, "ListUsers")
+		}
+	})
+}
+
 func TestToUserInfoResponse(t *testing.T) {
 	u := user.User {
 		Id:       1,
@@ -131,7 +863,7 @@ func TestToUserInfoResponse(t *testing.T) {
 		},
 	}
 	t.Run("success", func(t *testing.T) {
-		result := toUserInfoResponse(u, posts)
+		result := toUserInfoResponse(u, posts, nil)
 		assert.Equal(t, UserInfoResponse{
 			Id:       1,
 			UserInfo: UserInfo{
@@ -142,20 +874,40 @@ func TestToUserInfoResponse(t *testing.T) {
 			Posts:    []UserPost{
 				{
 					Id: posts[0].Id,
-					Title: posts[0].Title,
-					Body: posts[0].Body,
+					Title: &posts[0].Title,
+					Body: &posts[0].Body,
 				},
 				{
 					Id: posts[1].Id,
-					Title: posts[1].Title,
-					Body: posts[1].Body,
+					Title: &posts[1].Title,
+					Body: &posts[1].Body,
 				},
 			},
 		}, result)
 	})
 
+	t.Run("projected posts", func(t *testing.T) {
+		untitled := []user.Post{{UserId: 1, Id: 3}}
+		for fields, expected := range map[string]string{
+			"":         `[{"id":3,"title":"","body":""}]`,
+			"id,title": `[{"id":3,"title":""}]`,
+			"id":       `[{"id":3}]`,
+		} {
+			var projection map[string]bool
+			if fields != "" {
+				projection = make(map[string]bool)
+				for _, f := range strings.Split(fields, ",") {
+					projection[f] = true
+				}
+			}
+			b, err := json.Marshal(toUserInfoResponse(u, untitled, projection).Posts)
+			assert.NoError(t, err)
+			assert.JSONEq(t, expected, string(b), fields)
+		}
+	})
+
 	t.Run("no posts", func(t *testing.T) {
-		result := toUserInfoResponse(u, nil)
+		result := toUserInfoResponse(u, nil, nil)
 		assert.Equal(t, UserInfoResponse{
 			Id:       1,
 			UserInfo: UserInfo{
@@ -172,7 +924,7 @@ func TestHandleErrorResponse(t *testing.T) {
 	mockClient := new(MockUserClient)
 	out := &bytes.Buffer{}
 	logger := zerolog.New(out)
-	handler := NewHandler(mockClient, logger)
+	handler := NewHandler(mockClient, 0, logger)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/user-posts/1", nil)
 	t.Run("ApiClientError", func(t *testing.T) {
@@ -209,6 +961,19 @@ func TestHandleErrorResponse(t *testing.T) {
 		assert.JSONEq(t, `{"statusCode":500,"requestUrl":"/v1/user-posts/1","msg":"Oh no no no"}`, recorder.Body.String())
 	})
 
+	t.Run("CircuitOpenError", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.handleErrorResponse(user.CircuitOpenError{RetryAfter: 1500 * time.Millisecond}, recorder, req)
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	})
+
+	t.Run("RateLimitedError", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.handleErrorResponse(user.RateLimitedError{RetryAfter: 3 * time.Second}, recorder, req)
+		assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		assert.Equal(t, "3", recorder.Header().Get("Retry-After"))
+	})
 }
 
 func callErrorHandlerWithApiClientError(handler Handler, inStatus int, req *http.Request) *httptest.ResponseRecorder {
@@ -235,7 +1000,43 @@ func (m *MockUserClient) GetUserInfo(ctx context.Context, userID string) (user.U
 	args := m.Called(ctx, userID)
 	return args.Get(0).(user.User), args.Error(1)
 }
-func (m *MockUserClient) GetUserPosts(ctx context.Context, userID string) ([]user.Post, error) {
-	args := m.Called(ctx, userID)
+func (m *MockUserClient) GetUserPosts(ctx context.Context, userID string, q user.PostQuery) ([]user.Post, error) {
+	args := m.Called(ctx, userID, q)
 	return args.Get(0).([]user.Post), args.Error(1)
-}
\ No newline at end of file
+}
+func (m *MockUserClient) GetPostComments(ctx context.Context, postID string) ([]user.Comment, error) {
+	args := m.Called(ctx, postID)
+	return args.Get(0).([]user.Comment), args.Error(1)
+}
+func (m *MockUserClient) GetUserAlbums(ctx context.Context, userID string) ([]user.Album, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]user.Album), args.Error(1)
+}
+func (m *MockUserClient) GetAlbumPhotos(ctx context.Context, albumID string) ([]user.Photo, error) {
+	args := m.Called(ctx, albumID)
+	return args.Get(0).([]user.Photo), args.Error(1)
+}
+func (m *MockUserClient) GetUserTodos(ctx context.Context, userID string, completed *bool) ([]user.Todo, error) {
+	args := m.Called(ctx, userID, completed)
+	return args.Get(0).([]user.Todo), args.Error(1)
+}
+func (m *MockUserClient) CreatePost(ctx context.Context, post user.PostInput) (user.Post, error) {
+	args := m.Called(ctx, post)
+	return args.Get(0).(user.Post), args.Error(1)
+}
+func (m *MockUserClient) UpdatePost(ctx context.Context, postID string, post user.PostInput) (user.Post, error) {
+	args := m.Called(ctx, postID, post)
+	return args.Get(0).(user.Post), args.Error(1)
+}
+func (m *MockUserClient) PatchPost(ctx context.Context, postID string, patch user.PostPatch) (user.Post, error) {
+	args := m.Called(ctx, postID, patch)
+	return args.Get(0).(user.Post), args.Error(1)
+}
+func (m *MockUserClient) DeletePost(ctx context.Context, postID string) error {
+	args := m.Called(ctx, postID)
+	return args.Error(0)
+}
+func (m *MockUserClient) ListUsers(ctx context.Context, opts user.ListOptions) (user.UserList, error) {
+	args := m.Called(ctx, opts)
+	return args.Get(0).(user.UserList), args.Error(1)
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-redis/redis/v8"
 	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/hooliganlin/simple-go-rest-api/search"
 	"github.com/hooliganlin/simple-go-rest-api/user"
+	"github.com/hooliganlin/simple-go-rest-api/warmup"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog"
 	"net/http"
@@ -18,6 +22,27 @@ type AppConfig struct {
 	ServerPort			int				`envconfig:"SERVER_PORT" default:"8080"`
 	CacheTTL			time.Duration	`envconfig:"CACHE_TTL" default:"5m"`
 	CacheTTLInterval	time.Duration	`envconfig:"CACHE_TTL_INTERVAL" default:"10m"`
+	SearchRefreshInterval	time.Duration	`envconfig:"SEARCH_REFRESH_INTERVAL" default:"15m"`
+	// CacheBackend is either memory for a cache local to this replica, lru or lfu for a cache local to this
+	// replica bounded by CacheMaxEntries and CacheMaxBytes, redis for a cache shared by every replica, or tiered
+	// for a bounded local cache of CacheLocalTTL in front of the redis cache.
+	CacheBackend		string			`envconfig:"CACHE_BACKEND" default:"memory"`
+	CacheMaxEntries		int				`envconfig:"CACHE_MAX_ENTRIES" default:"10000"`
+	CacheMaxBytes		int64			`envconfig:"CACHE_MAX_BYTES" default:"67108864"`
+	CacheLocalTTL		time.Duration	`envconfig:"CACHE_LOCAL_TTL" default:"1m"`
+	CacheNamespace		string			`envconfig:"CACHE_NAMESPACE" default:"simple-go-rest-api"`
+	RedisAddr			string			`envconfig:"REDIS_ADDR" default:"127.0.0.1:6379"`
+	RedisPassword		string			`envconfig:"REDIS_PASSWORD"`
+	RedisDB				int				`envconfig:"REDIS_DB" default:"0"`
+	// WarmUserIDs and WarmSeedFile list the user ids, or ranges of ids such as 1-10, whose info and posts are
+	// cached before the server starts listening, and refreshed on every WarmInterval unless it is zero.
+	WarmUserIDs			[]string		`envconfig:"WARM_USER_IDS"`
+	WarmSeedFile		string			`envconfig:"WARM_SEED_FILE"`
+	WarmConcurrency		int				`envconfig:"WARM_CONCURRENCY" default:"5"`
+	WarmTimeout			time.Duration	`envconfig:"WARM_TIMEOUT" default:"1m"`
+	WarmInterval		time.Duration	`envconfig:"WARM_INTERVAL" default:"0s"`
+	// AdminToken is the bearer token of the /admin routes, which are disabled when it is empty.
+	AdminToken			string			`envconfig:"ADMIN_TOKEN"`
 }
 
 func main() {
@@ -33,16 +58,56 @@ func main() {
 	}
 
 	//set cache
-	c :=  cache.NewDefaultCache(config.CacheTTL, config.CacheTTLInterval)
+	c, err := newCache(config)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("unable to create cache")
+	}
 
 	userConfig := user.NewConfig()
 	userClient := user.NewDefaultClient(userConfig, c)
-	h := NewHandler(userClient, logger)
+	// responses may be cached downstream for as long as they are fresh in our own cache
+	cacheMaxAge := config.CacheTTL
+	if userConfig.CacheSoftTTL > 0 {
+		cacheMaxAge = userConfig.CacheSoftTTL
+	}
+	h := NewHandler(userClient, cacheMaxAge, logger)
+
+	searchIndex := search.NewIndex()
+	go search.NewRefresher(searchIndex, userClient, logger).Run(context.Background(), config.SearchRefreshInterval)
+	sh := NewSearchHandler(h, searchIndex)
+
+	if err = warmUp(config, userClient, logger); err != nil {
+		logger.Fatal().Err(err).Msg("unable to read the users to warm up")
+	}
 
 	r := chi.NewRouter()
 	r.Use(h.MiddlewareLogger)
 	r.Use(middleware.Recoverer)
+	r.Get("/v1/user-posts", h.GetBatchUserPostsHandler)
+	r.Post("/v1/user-posts", h.GetBatchUserPostsHandler)
 	r.Get("/v1/user-posts/{id}", h.GetUserPostsHandler)
+	r.Get("/v1/posts/{id}/comments", h.GetPostCommentsHandler)
+	r.Get("/v1/search", sh.GetSearchResultsHandler)
+	r.Get("/v1/users", h.ListUsersHandler)
+	r.Get("/v1/users/{id}", h.GetUserProfileHandler)
+	r.Get("/v1/users/{id}/albums", h.GetUserAlbumsHandler)
+	r.Get("/v1/albums/{id}/photos", h.GetAlbumPhotosHandler)
+	r.Get("/v1/users/{id}/todos", h.GetUserTodosHandler)
+	r.Post("/v1/posts", h.CreatePostHandler)
+	r.Put("/v1/posts/{id}", h.UpdatePostHandler)
+	r.Patch("/v1/posts/{id}", h.PatchPostHandler)
+	r.Delete("/v1/posts/{id}", h.DeletePostHandler)
+
+	if config.AdminToken != "" {
+		ah := NewAdminHandler(h, c, config.AdminToken)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(ah.MiddlewareAuth)
+			r.Get("/cache/stats", ah.GetCacheStatsHandler)
+			r.Get("/cache/keys", ah.GetCacheKeysHandler)
+			r.Delete("/cache/{key}", ah.DeleteCacheKeyHandler)
+			r.Delete("/cache", ah.PurgeCacheHandler)
+		})
+	}
 
 	s := http.Server {
 		Addr: fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort),
@@ -54,3 +119,62 @@ func main() {
 	}
 }
 
+// warmUp caches the users configured by the AppConfig, waiting up to the warm-up timeout, and re-warms them in
+// the background on every warm-up interval. A failed warm-up is logged and does not prevent the server from
+// starting, while an invalid list of users is returned as an error.
+func warmUp(config AppConfig, client user.Client, logger zerolog.Logger) error {
+	specs := config.WarmUserIDs
+	if config.WarmSeedFile != "" {
+		seeds, err := warmup.ReadSeedFile(config.WarmSeedFile)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, seeds...)
+	}
+	ids, err := warmup.ParseIDs(specs)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	w := warmup.NewWarmer(client, ids, config.WarmConcurrency, logger)
+	ctx, cancel := context.WithTimeout(context.Background(), config.WarmTimeout)
+	defer cancel()
+	if err = w.Warm(ctx); err != nil {
+		logger.Warn().Err(err).Msg("unable to warm up the cache")
+	}
+	if config.WarmInterval > 0 {
+		go w.Run(context.Background(), config.WarmInterval)
+	}
+	return nil
+}
+
+// newCache creates the cache backend selected by the AppConfig.
+func newCache(config AppConfig) (cache.InspectableCache, error) {
+	switch config.CacheBackend {
+	case "memory":
+		return cache.NewDefaultCache(config.CacheTTL, config.CacheTTLInterval), nil
+	case "lru", "lfu":
+		return cache.NewBoundedCache(cache.EvictionPolicy(config.CacheBackend), config.CacheMaxEntries, config.CacheMaxBytes, config.CacheTTL)
+	case "redis":
+		return cache.NewRedisCache(newRedisClient(config), config.CacheNamespace, config.CacheTTL), nil
+	case "tiered":
+		local, err := cache.NewBoundedCache(cache.EvictionLRU, config.CacheMaxEntries, config.CacheMaxBytes, config.CacheLocalTTL)
+		if err != nil {
+			return nil, err
+		}
+		client := newRedisClient(config)
+		shared := cache.NewRedisCache(client, config.CacheNamespace, config.CacheTTL)
+		bus := cache.NewRedisBus(client, config.CacheNamespace+":invalidations")
+		return cache.NewTieredCache(context.Background(), local, config.CacheLocalTTL, shared, bus)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q, expected memory, lru, lfu, redis or tiered", config.CacheBackend)
+	}
+}
+
+func newRedisClient(config AppConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddr,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+}
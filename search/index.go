@@ -0,0 +1,272 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	TypePosts    = "posts"
+	TypeComments = "comments"
+	TypeUsers    = "users"
+
+	// snippetRadius is the number of bytes of text kept on each side of the first match in a snippet.
+	snippetRadius  = 80
+	highlightOpen  = "<em>"
+	highlightClose = "</em>"
+)
+
+// Types are the document types that can be searched.
+var Types = []string{TypePosts, TypeComments, TypeUsers}
+
+// Document is a searchable resource. ParentId is the user of a post or the post of a comment.
+type Document struct {
+	Type     string
+	Id       int
+	ParentId int
+	Title    string
+	Text     string
+}
+
+// Query selects a page of the documents matching Text, restricted to Types when it is not empty.
+type Query struct {
+	Text  string
+	Types map[string]bool
+	Page  int
+	Limit int
+}
+
+// Results is a page of ranked hits along with the total number of documents that matched.
+type Results struct {
+	Total int   `json:"total"`
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
+	Hits  []Hit `json:"hits"`
+}
+
+// Hit is a document matching a Query. The query terms are wrapped in <em> tags in the Snippet.
+type Hit struct {
+	Type     string  `json:"type"`
+	Id       int     `json:"id"`
+	ParentId int     `json:"parentId,omitempty"`
+	Title    string  `json:"title"`
+	Snippet  string  `json:"snippet"`
+	Score    float64 `json:"score"`
+}
+
+// Index is an in-process inverted index over Documents. It is safe for concurrent use, and Replace swaps in
+// a new set of documents without blocking searches for longer than the swap itself.
+type Index struct {
+	mu   sync.RWMutex
+	docs []Document
+	// postings maps a term to the term frequency of every document containing it, keyed by document position.
+	postings  map[string]map[int]int
+	docLens   []int
+	updatedAt time.Time
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[int]int),
+	}
+}
+
+// Replace rebuilds the index from docs.
+func (ix *Index) Replace(docs []Document) {
+	postings := make(map[string]map[int]int)
+	docLens := make([]int, len(docs))
+	for i, d := range docs {
+		// title terms are counted twice so that a match in the title outranks a match in the text
+		terms := append(tokenize(d.Title), tokenize(d.Title)...)
+		terms = append(terms, tokenize(d.Text)...)
+		docLens[i] = len(terms)
+		for _, t := range terms {
+			if postings[t.term] == nil {
+				postings[t.term] = make(map[int]int)
+			}
+			postings[t.term][i]++
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.docs = docs
+	ix.postings = postings
+	ix.docLens = docLens
+	ix.updatedAt = time.Now()
+}
+
+// UpdatedAt returns when the index was last replaced, or the zero time if it has never been built.
+func (ix *Index) UpdatedAt() time.Time {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.updatedAt
+}
+
+// Search ranks the documents matching any term of the query by TF-IDF and returns the requested page.
+func (ix *Index) Search(q Query) Results {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	results := Results{Page: q.Page, Limit: q.Limit, Hits: []Hit{}}
+	terms := uniqueTerms(q.Text)
+	scores := make(map[int]float64)
+	for _, term := range terms {
+		postings := ix.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(len(ix.docs))/float64(len(postings)))
+		for i, tf := range postings {
+			if len(q.Types) > 0 && !q.Types[ix.docs[i].Type] {
+				continue
+			}
+			scores[i] += float64(tf) / math.Sqrt(float64(ix.docLens[i])) * idf
+		}
+	}
+
+	ranked := make([]int, 0, len(scores))
+	for i := range scores {
+		ranked = append(ranked, i)
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if scores[ranked[a]] != scores[ranked[b]] {
+			return scores[ranked[a]] > scores[ranked[b]]
+		}
+		return ranked[a] < ranked[b]
+	})
+	results.Total = len(ranked)
+
+	start := (q.Page - 1) * q.Limit
+	if start < 0 || start >= len(ranked) {
+		return results
+	}
+	end := start + q.Limit
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+	for _, i := range ranked[start:end] {
+		d := ix.docs[i]
+		results.Hits = append(results.Hits, Hit{
+			Type:     d.Type,
+			Id:       d.Id,
+			ParentId: d.ParentId,
+			Title:    d.Title,
+			Snippet:  snippet(d.Text, terms),
+			Score:    math.Round(scores[i]*1000) / 1000,
+		})
+	}
+	return results
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower cased terms of letters and digits along with their byte offsets in text.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isTermRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isTermRune && start < 0 {
+			start = i
+		}
+		if !isTermRune && start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+func uniqueTerms(text string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range tokenize(text) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+	return terms
+}
+
+// snippet returns the part of text around the first occurrence of any of the terms, with every occurrence
+// of the terms highlighted. The text is HTML escaped since the highlighting is markup. The start of the text is
+// returned when none of the terms occur in it.
+func snippet(text string, terms []string) string {
+	isTerm := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		isTerm[t] = true
+	}
+	tokens := tokenize(text)
+	first := -1
+	for i, t := range tokens {
+		if isTerm[t.term] {
+			first = i
+			break
+		}
+	}
+
+	from, to := 0, len(text)
+	if first >= 0 {
+		from = tokens[first].start - snippetRadius
+		to = tokens[first].end + snippetRadius
+	} else {
+		to = 2 * snippetRadius
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to > len(text) {
+		to = len(text)
+	}
+	// widen the window to whole tokens so that no term is cut in half
+	for _, t := range tokens {
+		if t.start < from && t.end > from {
+			from = t.start
+		}
+		if t.start < to && t.end > to {
+			to = t.end
+		}
+	}
+	// and to whole runes so that no multibyte character is cut in half
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, t := range tokens {
+		if t.start < from || t.end > to || !isTerm[t.term] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		b.WriteString(highlightOpen)
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString(highlightClose)
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(text[pos:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSearch(t *testing.T) {
+	ix := NewIndex()
+	ix.Replace([]Document{
+		{Type: TypePosts, Id: 1, ParentId: 1, Title: "Brewing coffee", Text: "How to brew a great cup of coffee at home."},
+		{Type: TypePosts, Id: 2, ParentId: 1, Title: "Tea time", Text: "Tea is better than coffee, some say."},
+		{Type: TypeComments, Id: 7, ParentId: 2, Title: "disagree", Text: "Nothing beats an espresso."},
+		{Type: TypeUsers, Id: 1, Title: "Bob Loblaw", Text: "bob bob@lawyer.com"},
+	})
+
+	t.Run("ranks title matches first", func(t *testing.T) {
+		results := ix.Search(Query{Text: "coffee", Page: 1, Limit: 10})
+		assert.Equal(t, 2, results.Total)
+		assert.Equal(t, 1, results.Hits[0].Id)
+		assert.Equal(t, 2, results.Hits[1].Id)
+		assert.Greater(t, results.Hits[0].Score, results.Hits[1].Score)
+	})
+
+	t.Run("highlights matches in snippet", func(t *testing.T) {
+		results := ix.Search(Query{Text: "Coffee", Page: 1, Limit: 10})
+		assert.Equal(t, "How to brew a great cup of <em>coffee</em> at home.", results.Hits[0].Snippet)
+	})
+
+	t.Run("filters by type", func(t *testing.T) {
+		results := ix.Search(Query{Text: "coffee espresso bob", Types: map[string]bool{TypeComments: true}, Page: 1, Limit: 10})
+		assert.Equal(t, 1, results.Total)
+		assert.Equal(t, Hit{
+			Type:     TypeComments,
+			Id:       7,
+			ParentId: 2,
+			Title:    "disagree",
+			Snippet:  "Nothing beats an <em>espresso</em>.",
+			Score:    results.Hits[0].Score,
+		}, results.Hits[0])
+	})
+
+	t.Run("paginates", func(t *testing.T) {
+		results := ix.Search(Query{Text: "coffee", Page: 2, Limit: 1})
+		assert.Equal(t, 2, results.Total)
+		assert.Len(t, results.Hits, 1)
+		assert.Equal(t, 2, results.Hits[0].Id)
+
+		results = ix.Search(Query{Text: "coffee", Page: 3, Limit: 1})
+		assert.Equal(t, 2, results.Total)
+		assert.Empty(t, results.Hits)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		results := ix.Search(Query{Text: "pancakes", Page: 1, Limit: 10})
+		assert.Equal(t, Results{Page: 1, Limit: 10, Hits: []Hit{}}, results)
+	})
+}
+
+func TestSnippet(t *testing.T) {
+	t.Run("truncates around the first match", func(t *testing.T) {
+		text := "lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore " +
+			"et dolore magna aliqua ut enim ad minim veniam quis nostrud exercitation ullamco laboris nisi ut " +
+			"aliquip ex ea commodo consequat duis aute irure dolor in reprehenderit in voluptate velit esse"
+		s := snippet(text, []string{"exercitation"})
+		assert.Contains(t, s, "<em>exercitation</em>")
+		assert.True(t, len(s) < len(text))
+		assert.Equal(t, "…", s[:len("…")])
+		assert.Equal(t, "…", s[len(s)-len("…"):])
+	})
+
+	t.Run("collapses whitespace", func(t *testing.T) {
+		assert.Equal(t, "quia et <em>suscipit</em> recusandae", snippet("quia et\nsuscipit\nrecusandae", []string{"suscipit"}))
+	})
+
+	t.Run("cuts at rune boundaries", func(t *testing.T) {
+		dashes := strings.Repeat("—", snippetRadius)
+		s := snippet(dashes+" match "+dashes, []string{"match"})
+		assert.True(t, utf8.ValidString(s))
+		assert.Contains(t, s, "<em>match</em>")
+	})
+
+	t.Run("escapes the text", func(t *testing.T) {
+		s := snippet(`<script>alert("match")</script>`, []string{"match"})
+		assert.Equal(t, "&lt;script&gt;alert(&#34;<em>match</em>&#34;)&lt;/script&gt;", s)
+	})
+
+	t.Run("no match returns the start of the text", func(t *testing.T) {
+		assert.Equal(t, "short text", snippet("short text", []string{"other"}))
+	})
+}
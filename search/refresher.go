@@ -0,0 +1,161 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"github.com/hooliganlin/simple-go-rest-api/user"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxConcurrentFetches limits how many upstream fetches run at once while the documents are collected.
+const maxConcurrentFetches = 5
+
+// Refresher rebuilds an Index from the users, posts and comments fetched through a user.Client.
+type Refresher struct {
+	index  *Index
+	client user.Client
+	logger zerolog.Logger
+}
+
+func NewRefresher(index *Index, client user.Client, logger zerolog.Logger) Refresher {
+	return Refresher{
+		index:  index,
+		client: client,
+		logger: logger,
+	}
+}
+
+// Run refreshes the index right away and then on every interval until ctx is done, or only once when the
+// interval is not positive. A failed refresh is logged and the index keeps serving the documents of the last
+// successful refresh.
+func (r Refresher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		r.refreshAndLog(ctx)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.refreshAndLog(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r Refresher) refreshAndLog(ctx context.Context) {
+	startTime := time.Now()
+	if err := r.Refresh(ctx); err != nil {
+		r.logger.Error().Err(err).Msg("unable to refresh search index")
+		return
+	}
+	r.logger.Info().
+		Str("duration", fmt.Sprintf("%.4fms", time.Since(startTime).Seconds()*1000)).
+		Msg("refreshed search index")
+}
+
+// Refresh fetches every user along with their posts and the comments of those posts, and replaces the
+// documents of the index with them.
+func (r Refresher) Refresh(ctx context.Context) error {
+	users, err := r.listAllUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	docs := make([]Document, 0, len(users))
+	addDocs := func(d ...Document) {
+		mu.Lock()
+		defer mu.Unlock()
+		docs = append(docs, d...)
+	}
+
+	sem := semaphore.NewWeighted(maxConcurrentFetches)
+	g, ctx := errgroup.WithContext(ctx)
+	fetch := func(f func() error) error {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
+		g.Go(func() error {
+			defer sem.Release(1)
+			return f()
+		})
+		return nil
+	}
+
+	for _, u := range users {
+		addDocs(userDocument(u))
+	}
+	for _, u := range users {
+		u := u
+		err = fetch(func() error {
+			posts, err := r.client.GetUserPosts(ctx, strconv.Itoa(u.Id), user.PostQuery{})
+			if err != nil {
+				return err
+			}
+			for _, p := range posts {
+				addDocs(Document{Type: TypePosts, Id: p.Id, ParentId: p.UserId, Title: p.Title, Text: p.Body})
+			}
+			for _, p := range posts {
+				p := p
+				// the comment fetches acquire the semaphore on their own goroutine since this post fetch
+				// still holds its slot
+				g.Go(func() error {
+					if err := sem.Acquire(ctx, 1); err != nil {
+						return err
+					}
+					defer sem.Release(1)
+					comments, err := r.client.GetPostComments(ctx, strconv.Itoa(p.Id))
+					if err != nil {
+						return err
+					}
+					for _, c := range comments {
+						addDocs(Document{Type: TypeComments, Id: c.Id, ParentId: c.PostId, Title: c.Name, Text: c.Body})
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+	if werr := g.Wait(); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+
+	r.index.Replace(docs)
+	return nil
+}
+
+// listAllUsers pages through the user listing until every user has been fetched.
+func (r Refresher) listAllUsers(ctx context.Context) ([]user.User, error) {
+	var users []user.User
+	for page := 1; ; page++ {
+		list, err := r.client.ListUsers(ctx, user.ListOptions{Page: page, Limit: user.MaxListLimit, Order: "asc"})
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, list.Users...)
+		if len(list.Users) == 0 || len(users) >= list.Total {
+			return users, nil
+		}
+	}
+}
+
+func userDocument(u user.User) Document {
+	text := strings.Join([]string{u.Username, u.Email, u.Company.Name, u.Company.CatchPhrase}, " ")
+	return Document{Type: TypeUsers, Id: u.Id, Title: u.Name, Text: text}
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"context"
+	"github.com/hooliganlin/simple-go-rest-api/user"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	t.Run("indexes users, posts and comments", func(t *testing.T) {
+		client := fakeClient{
+			users: []user.User{{Id: 1, Name: "Bob Loblaw", Username: "bob"}},
+			posts: map[string][]user.Post{
+				"1": {{UserId: 1, Id: 10, Title: "Brewing coffee", Body: "with a french press"}},
+			},
+			comments: map[string][]user.Comment{
+				"10": {{PostId: 10, Id: 100, Name: "nice", Body: "I prefer espresso"}},
+			},
+		}
+		ix := NewIndex()
+		assert.NoError(t, NewRefresher(ix, client, zerolog.New(io.Discard)).Refresh(context.Background()))
+
+		assert.False(t, ix.UpdatedAt().IsZero())
+		assert.Equal(t, TypeUsers, ix.Search(Query{Text: "loblaw", Page: 1, Limit: 10}).Hits[0].Type)
+		assert.Equal(t, 10, ix.Search(Query{Text: "press", Page: 1, Limit: 10}).Hits[0].Id)
+		assert.Equal(t, 100, ix.Search(Query{Text: "espresso", Page: 1, Limit: 10}).Hits[0].Id)
+	})
+
+	t.Run("keeps the previous documents on failure", func(t *testing.T) {
+		ix := NewIndex()
+		ix.Replace([]Document{{Type: TypePosts, Id: 1, Title: "coffee"}})
+		client := fakeClient{
+			users: []user.User{{Id: 1}},
+			err:   errors.New("upstream unavailable"),
+		}
+		assert.Error(t, NewRefresher(ix, client, zerolog.New(io.Discard)).Refresh(context.Background()))
+		assert.Equal(t, 1, ix.Search(Query{Text: "coffee", Page: 1, Limit: 10}).Total)
+	})
+
+	t.Run("refreshes once without an interval", func(t *testing.T) {
+		ix := NewIndex()
+		client := fakeClient{users: []user.User{{Id: 1, Name: "Bob Loblaw"}}}
+		NewRefresher(ix, client, zerolog.New(io.Discard)).Run(context.Background(), 0)
+		assert.Equal(t, 1, ix.Search(Query{Text: "loblaw", Page: 1, Limit: 10}).Total)
+	})
+}
+
+// fakeClient serves the user listing, posts and comments used by a Refresher.
+type fakeClient struct {
+	user.Client
+	users    []user.User
+	posts    map[string][]user.Post
+	comments map[string][]user.Comment
+	err      error
+}
+
+func (c fakeClient) ListUsers(_ context.Context, opts user.ListOptions) (user.UserList, error) {
+	if opts.Page > 1 {
+		return user.UserList{Total: len(c.users)}, nil
+	}
+	return user.UserList{Users: c.users, Total: len(c.users)}, nil
+}
+func (c fakeClient) GetUserPosts(_ context.Context, userID string, _ user.PostQuery) ([]user.Post, error) {
+	return c.posts[userID], c.err
+}
+func (c fakeClient) GetPostComments(_ context.Context, postID string) ([]user.Comment, error) {
+	return c.comments[postID], c.err
+}
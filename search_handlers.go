@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/hooliganlin/simple-go-rest-api/search"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+// SearchHandler serves full-text searches over the posts, comments and users in a search.Index.
+type SearchHandler struct {
+	Handler
+	index *search.Index
+}
+
+func NewSearchHandler(h Handler, index *search.Index) SearchHandler {
+	return SearchHandler{
+		Handler: h,
+		index:   index,
+	}
+}
+
+// GetSearchResultsHandler searches the index for the q query parameter. The optional comma separated type
+// query parameter restricts the search to posts, comments or users, and the page and limit query parameters
+// select a page of the ranked results.
+func (h SearchHandler) GetSearchResultsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := searchQueryParams(r)
+	if err != nil {
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusBadRequest), w, r)
+		return
+	}
+	if h.index.UpdatedAt().IsZero() {
+		err = errors.New("search index is not ready yet")
+		h.handleErrorResponse(NewServerErrorResponse(err, r.URL.String(), http.StatusServiceUnavailable), w, r)
+		return
+	}
+
+	if err = h.writeCacheableJSON(w, r, h.index.Search(q)); err != nil {
+		h.handleErrorResponse(err, w, r)
+		return
+	}
+}
+
+// searchQueryParams reads the q, type, page and limit query parameters of a search.
+func searchQueryParams(r *http.Request) (search.Query, error) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		return search.Query{}, errors.New("the q query parameter is required")
+	}
+	page, limit, err := pageParams(r)
+	if err != nil {
+		return search.Query{}, err
+	}
+	if err = validatePage(page, limit); err != nil {
+		return search.Query{}, err
+	}
+
+	types := make(map[string]bool)
+	for _, t := range strings.Split(r.URL.Query().Get("type"), ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !isSearchType(t) {
+			return search.Query{}, errors.Errorf("unknown type %q, expected any of %s", t, strings.Join(search.Types, ","))
+		}
+		types[t] = true
+	}
+	return search.Query{
+		Text:  text,
+		Types: types,
+		Page:  page,
+		Limit: limit,
+	}, nil
+}
+
+func isSearchType(searchType string) bool {
+	for _, t := range search.Types {
+		if t == searchType {
+			return true
+		}
+	}
+	return false
+}
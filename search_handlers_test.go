@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hooliganlin/simple-go-rest-api/search"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetSearchResultsHandler(t *testing.T) {
+	index := search.NewIndex()
+	handler := NewSearchHandler(NewHandler(new(MockUserClient), 0, zerolog.New(io.Discard)), index)
+
+	t.Run("index not ready", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.GetSearchResultsHandler(recorder, httptest.NewRequest(http.MethodGet, "/v1/search?q=coffee", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	})
+
+	index.Replace([]search.Document{
+		{Type: search.TypePosts, Id: 1, ParentId: 1, Title: "Brewing coffee", Text: "with a french press"},
+		{Type: search.TypeComments, Id: 2, ParentId: 1, Title: "nice", Text: "more coffee please"},
+	})
+
+	t.Run("successful response", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.GetSearchResultsHandler(recorder, httptest.NewRequest(http.MethodGet, "/v1/search?q=coffee&type=comments", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var results search.Results
+		if err := json.NewDecoder(recorder.Body).Decode(&results); err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, 1, results.Total)
+		assert.Equal(t, 1, results.Page)
+		assert.Equal(t, defaultListLimit, results.Limit)
+		assert.Equal(t, "more <em>coffee</em> please", results.Hits[0].Snippet)
+	})
+
+	t.Run("ignores listing parameters", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		target := "/v1/search?q=coffee&sort=score&order=relevance&limit=1"
+		handler.GetSearchResultsHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		for _, target := range []string{
+			"/v1/search",
+			"/v1/search?q=coffee&type=albums",
+			"/v1/search?q=coffee&page=0",
+			"/v1/search?q=coffee&limit=1000",
+		} {
+			recorder := httptest.NewRecorder()
+			handler.GetSearchResultsHandler(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, target)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitOpenError is returned without calling the upstream API while the circuit breaker is open.
+type CircuitOpenError struct {
+	// RetryAfter is the remaining cool-down before the upstream API is probed again.
+	RetryAfter time.Duration
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("upstream API is unavailable, circuit breaker is open for %s", e.RetryAfter)
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops calling the upstream API after consecutive failures. It opens once failureThreshold
+// calls in a row have failed, fails every call fast for the cool-down, and then lets a single probe call
+// through at a time until successThreshold probes in a row have succeeded. A failed probe opens it again.
+// A nil circuitBreaker lets every call through.
+type circuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	successThreshold int
+	cooldown         time.Duration
+	state            breakerState
+	failures         int
+	successes        int
+	openedAt         time.Time
+	probing          bool
+}
+
+// newCircuitBreaker returns nil when the breaker is disabled by a zero failure threshold.
+func newCircuitBreaker(c Config) *circuitBreaker {
+	if c.BreakerFailureThreshold <= 0 {
+		return nil
+	}
+	successThreshold := c.BreakerSuccessThreshold
+	if successThreshold < 1 {
+		successThreshold = 1
+	}
+	return &circuitBreaker{
+		failureThreshold: c.BreakerFailureThreshold,
+		successThreshold: successThreshold,
+		cooldown:         c.BreakerCooldown,
+	}
+}
+
+// do calls fn unless the breaker is open, and records its outcome. A call cancelled by its context is
+// neither a success nor a failure.
+func (b *circuitBreaker) do(ctx context.Context, fn func() ([]byte, http.Header, error)) ([]byte, http.Header, error) {
+	if b == nil {
+		return fn()
+	}
+	probe, err := b.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	body, header, err := fn()
+	b.record(probe, ctx.Err() == nil, isUpstreamFailure(err))
+	return body, header, err
+}
+
+// allow reports whether the call may go through, and whether it is the probe of a half-open breaker.
+func (b *circuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if remaining := b.cooldown - time.Since(b.openedAt); remaining > 0 {
+			return false, CircuitOpenError{RetryAfter: remaining}
+		}
+		b.transition(breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return false, CircuitOpenError{}
+		}
+		b.probing = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (b *circuitBreaker) record(probe bool, completed bool, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if !completed {
+		return
+	}
+	switch {
+	case failed && probe:
+		b.transition(breakerOpen)
+	case failed && b.state == breakerClosed:
+		if b.failures++; b.failures >= b.failureThreshold {
+			b.transition(breakerOpen)
+		}
+	case !failed && probe:
+		if b.successes++; b.successes >= b.successThreshold {
+			b.transition(breakerClosed)
+		}
+	case !failed && b.state == breakerClosed:
+		b.failures = 0
+	}
+}
+
+func (b *circuitBreaker) transition(state breakerState) {
+	log.Warn().
+		Str("from", b.state.String()).
+		Str("to", state.String()).
+		Int("failures", b.failures).
+		Msg("upstream circuit breaker state changed")
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	if state == breakerOpen {
+		b.openedAt = time.Now()
+	}
+}
+
+// isUpstreamFailure reports whether the error is a connection error or an upstream 5xx response, as opposed to
+// a client error that says nothing about the health of the upstream API.
+func isUpstreamFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr APIClientError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
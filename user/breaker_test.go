@@ -0,0 +1,118 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests int32
+	var healthy int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/users/404" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(User{Id: 1})
+	}))
+	defer testServer.Close()
+	client := NewDefaultClient(Config{
+		BaseURL:                 testServer.URL,
+		BreakerFailureThreshold: 2,
+		BreakerSuccessThreshold: 1,
+		BreakerCooldown:         50 * time.Millisecond,
+	}, cache.NullCache{})
+	ctx := context.Background()
+
+	// two upstream failures open the breaker, which then fails fast
+	for i := 0; i < 2; i++ {
+		_, err := client.GetUserInfo(ctx, "1")
+		assert.IsType(t, APIClientError{}, err)
+	}
+	_, err := client.GetUserInfo(ctx, "1")
+	assert.IsType(t, CircuitOpenError{}, err)
+	assert.Greater(t, int64(err.(CircuitOpenError).RetryAfter), int64(0))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+
+	// a failed probe after the cool-down opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	_, err = client.GetUserInfo(ctx, "1")
+	assert.IsType(t, APIClientError{}, err)
+	_, err = client.GetUserInfo(ctx, "1")
+	assert.IsType(t, CircuitOpenError{}, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+
+	// a successful probe closes the breaker, and client errors do not open it
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+	_, err = client.GetUserInfo(ctx, "1")
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = client.GetUserInfo(ctx, "404")
+		assert.IsType(t, APIClientError{}, err)
+	}
+	_, err = client.GetUserInfo(ctx, "1")
+	assert.NoError(t, err)
+}
+
+func TestCircuitBreakerServesExpiredCache(t *testing.T) {
+	var healthy int32 = 1
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(User{Id: 1, Name: "Expired Yolanda"})
+	}))
+	defer testServer.Close()
+	c, _ := cache.NewBoundedCache(cache.EvictionLRU, 10, 0, time.Hour)
+	config := Config{
+		BaseURL:                 testServer.URL,
+		CacheHardTTL:            20 * time.Millisecond,
+		BreakerFailureThreshold: 1,
+		BreakerCooldown:         time.Minute,
+	}
+
+	t.Run("within the stale-if-error TTL", func(t *testing.T) {
+		atomic.StoreInt32(&healthy, 1)
+		config.CacheStaleIfErrorTTL = time.Hour
+		client := NewDefaultClient(config, c)
+		_, err := client.GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+
+		atomic.StoreInt32(&healthy, 0)
+		time.Sleep(30 * time.Millisecond)
+		_, err = client.GetUserInfo(context.Background(), "1")
+		assert.IsType(t, APIClientError{}, err)
+		u, err := client.GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "Expired Yolanda", u.Name)
+	})
+
+	t.Run("past the stale-if-error TTL", func(t *testing.T) {
+		atomic.StoreInt32(&healthy, 1)
+		config.CacheStaleIfErrorTTL = 0
+		client := NewDefaultClient(config, c)
+		_, err := client.GetUserInfo(context.Background(), "2")
+		assert.NoError(t, err)
+
+		atomic.StoreInt32(&healthy, 0)
+		time.Sleep(30 * time.Millisecond)
+		_, err = client.GetUserInfo(context.Background(), "2")
+		assert.IsType(t, APIClientError{}, err)
+		_, err = client.GetUserInfo(context.Background(), "2")
+		assert.IsType(t, CircuitOpenError{}, err)
+	})
+}
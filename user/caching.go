@@ -0,0 +1,162 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+// fetchFunc fetches the JSON encoded value of a cache key from the upstream API.
+type fetchFunc func(ctx context.Context) ([]byte, error)
+
+// cacheEntry is the envelope of a cached upstream response. StoredAt determines whether the value is stale.
+// NotFound holds the error of a cached 404 response instead of a value.
+type cacheEntry struct {
+	StoredAt time.Time       `json:"storedAt"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	NotFound *APIClientError `json:"notFound,omitempty"`
+}
+
+// cacheRefreshKey is the context key of the calls refreshing the cache, see WithCacheRefresh.
+type cacheRefreshKey struct{}
+
+// WithCacheRefresh returns a context making the calls of a DefaultClient skip the cached responses, fetching
+// them from the upstream API and overwriting the cache with them.
+func WithCacheRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheRefreshKey{}, true)
+}
+
+// getCached decodes the cached value of the key into v, and fetches and caches it on a miss. A value older
+// than the soft TTL is returned right away and refreshed in the background, and a value older than the hard
+// TTL is treated as a miss, unless the circuit breaker is open and the value is within the stale-if-error TTL.
+// A cached 404 response is returned as its APIClientError until the not found TTL. The cache is not read for a
+// context of WithCacheRefresh.
+func (c DefaultClient) getCached(ctx context.Context, key string, v interface{}, fetch fetchFunc) error {
+	var entry cacheEntry
+	var age time.Duration
+	if refresh, _ := ctx.Value(cacheRefreshKey{}).(bool); !refresh && c.cacheGet(ctx, key, &entry) {
+		age = time.Since(entry.StoredAt)
+		if entry.NotFound != nil {
+			if age < c.notFoundTTL {
+				return *entry.NotFound
+			}
+		} else if c.hardTTL == 0 || age < c.hardTTL {
+			if err := json.Unmarshal(entry.Value, v); err == nil {
+				if c.softTTL > 0 && age >= c.softTTL {
+					c.refreshInBackground(key, fetch)
+				}
+				return nil
+			}
+			log.Warn().Str("key", key).Msg("unable to decode cached value, falling back to upstream")
+		}
+	}
+
+	b, err := c.fetchShared(ctx, key, fetch)
+	if errors.As(err, &CircuitOpenError{}) && entry.Value != nil && age < c.hardTTL+c.staleIfErrorTTL {
+		if json.Unmarshal(entry.Value, v) == nil {
+			log.Warn().Str("key", key).Msg("circuit breaker is open, serving expired cached value")
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// fetchShared fetches and caches the value of the key, sharing a single upstream call between every
+// concurrent caller. The upstream call is detached from the context of the callers so that a caller giving up
+// does not fail the fetch for the others, while the caller itself still returns as soon as its context is done.
+func (c DefaultClient) fetchShared(ctx context.Context, key string, fetch fetchFunc) ([]byte, error) {
+	ch := c.fetches.DoChan(key, func() (interface{}, error) {
+		fetchCtx := context.Background()
+		b, err := fetch(fetchCtx)
+		if err != nil {
+			var apiErr APIClientError
+			if c.notFoundTTL > 0 && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				c.cacheSetNotFound(fetchCtx, key, apiErr)
+			}
+			return nil, err
+		}
+		if !json.Valid(b) {
+			return nil, errors.New("upstream returned invalid JSON")
+		}
+		c.cacheSet(fetchCtx, key, b)
+		return b, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	}
+}
+
+// refreshInBackground fetches and caches the value of the key on its own goroutine, unless a refresh of the
+// key is already running. A failed refresh is logged and the stale value keeps being served.
+func (c DefaultClient) refreshInBackground(key string, fetch fetchFunc) {
+	if _, running := c.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer c.refreshing.Delete(key)
+		if _, err := c.fetchShared(context.Background(), key, fetch); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("unable to refresh stale cached value")
+		}
+	}()
+}
+
+// cacheGet decodes the cached value of the key into v. A failing cache is logged and reported as a miss so
+// that the value is fetched from the upstream API instead.
+func (c DefaultClient) cacheGet(ctx context.Context, key string, v interface{}) bool {
+	ok, err := cache.GetJSON(ctx, c.cache, key, v)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("unable to read from cache, falling back to upstream")
+		return false
+	}
+	return ok
+}
+
+// cacheSet stores the JSON value in a cacheEntry. The entry expires after the hard TTL and the stale-if-error
+// TTL, so that it can still be served while the circuit breaker is open, or after the default expiration of the
+// cache when there is no hard TTL. A failing cache is logged and the value is not cached.
+func (c DefaultClient) cacheSet(ctx context.Context, key string, value []byte) {
+	b, err := json.Marshal(cacheEntry{StoredAt: time.Now(), Value: value})
+	if err == nil {
+		if c.hardTTL > 0 {
+			err = c.cache.SetWithTTL(ctx, key, b, c.hardTTL+c.staleIfErrorTTL)
+		} else {
+			err = c.cache.Set(ctx, key, b)
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("unable to write to cache")
+	}
+}
+
+// cacheSetNotFound stores the error of a 404 response in a cacheEntry expiring after the not found TTL. A
+// failing cache is logged and the error is not cached.
+func (c DefaultClient) cacheSetNotFound(ctx context.Context, key string, notFound APIClientError) {
+	b, err := json.Marshal(cacheEntry{StoredAt: time.Now(), NotFound: &notFound})
+	if err == nil {
+		err = c.cache.SetWithTTL(ctx, key, b, c.notFoundTTL)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("unable to write to cache")
+	}
+}
+
+// cacheDelete deletes the cached value of the key. A failing cache is logged since the stale value is
+// served until it expires.
+func (c DefaultClient) cacheDelete(ctx context.Context, key string) {
+	if err := c.cache.Delete(ctx, key); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("unable to invalidate cached value")
+	}
+}
@@ -0,0 +1,249 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	staleUser := User{Id: 1, Name: "Stale Yolanda"}
+	freshUser := User{Id: 1, Name: "Fresh Yolanda"}
+	config := func(baseURL string) Config {
+		return Config{
+			BaseURL:      baseURL,
+			CacheSoftTTL: time.Minute,
+			CacheHardTTL: time.Hour,
+		}
+	}
+	// seedCache stores the user in a cache entry as old as age
+	seedCache := func(t *testing.T, c cache.Cache, u User, age time.Duration) {
+		value, err := json.Marshal(u)
+		assert.NoError(t, err)
+		entry, err := json.Marshal(cacheEntry{StoredAt: time.Now().Add(-age), Value: value})
+		assert.NoError(t, err)
+		assert.NoError(t, c.Set(context.Background(), userCacheKey("1"), entry))
+	}
+	cachedUser := func(c cache.Cache) User {
+		var entry cacheEntry
+		var u User
+		if ok, _ := cache.GetJSON(context.Background(), c, userCacheKey("1"), &entry); ok {
+			_ = json.Unmarshal(entry.Value, &u)
+		}
+		return u
+	}
+
+	t.Run("fresh value is served without refresh", func(t *testing.T) {
+		var requests int32
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			_ = json.NewEncoder(w).Encode(freshUser)
+		}))
+		defer testServer.Close()
+		c := cache.NewDefaultCache(time.Hour, time.Hour)
+		seedCache(t, c, staleUser, time.Second)
+
+		u, err := NewDefaultClient(config(testServer.URL), c).GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, staleUser, u)
+		time.Sleep(10 * time.Millisecond)
+		assert.EqualValues(t, 0, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("stale value is served and refreshed once", func(t *testing.T) {
+		var requests int32
+		release := make(chan struct{})
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			<-release
+			_ = json.NewEncoder(w).Encode(freshUser)
+		}))
+		defer testServer.Close()
+		c := cache.NewDefaultCache(time.Hour, time.Hour)
+		seedCache(t, c, staleUser, 2*time.Minute)
+		client := NewDefaultClient(config(testServer.URL), c)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				u, err := client.GetUserInfo(context.Background(), "1")
+				assert.NoError(t, err)
+				assert.Equal(t, staleUser, u)
+			}()
+		}
+		wg.Wait()
+		close(release)
+
+		assert.Eventually(t, func() bool {
+			return cachedUser(c) == freshUser
+		}, time.Second, 5*time.Millisecond)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("stale value is kept while the upstream fails", func(t *testing.T) {
+		var requests int32
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer testServer.Close()
+		c := cache.NewDefaultCache(time.Hour, time.Hour)
+		seedCache(t, c, staleUser, 2*time.Minute)
+
+		u, err := NewDefaultClient(config(testServer.URL), c).GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, staleUser, u)
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt32(&requests) == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, staleUser, cachedUser(c))
+	})
+
+	t.Run("value past the hard ttl is fetched", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(freshUser)
+		}))
+		defer testServer.Close()
+		c := cache.NewDefaultCache(time.Hour, time.Hour)
+		seedCache(t, c, staleUser, 2*time.Hour)
+
+		u, err := NewDefaultClient(config(testServer.URL), c).GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, freshUser, u)
+	})
+
+	t.Run("value past the hard ttl fails with the upstream", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer testServer.Close()
+		c := cache.NewDefaultCache(time.Hour, time.Hour)
+		seedCache(t, c, staleUser, 2*time.Hour)
+
+		_, err := NewDefaultClient(config(testServer.URL), c).GetUserInfo(context.Background(), "1")
+		assert.Error(t, err)
+	})
+}
+
+func TestFetchCoalescing(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		_ = json.NewEncoder(w).Encode(User{Id: 1, Name: "Yolanda"})
+	}))
+	defer testServer.Close()
+	c := cache.NewDefaultCache(time.Hour, time.Hour)
+	client := NewDefaultClient(Config{BaseURL: testServer.URL}, c)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := client.GetUserInfo(cancelledCtx, "1")
+		cancelled <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&requests) == 1
+	}, time.Second, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := client.GetUserInfo(context.Background(), "1")
+			assert.NoError(t, err)
+			assert.Equal(t, "Yolanda", u.Name)
+		}()
+	}
+	cancel()
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	var entry cacheEntry
+	ok, err := cache.GetJSON(context.Background(), c, userCacheKey("1"), &entry)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestNotFoundCaching(t *testing.T) {
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer testServer.Close()
+
+	t.Run("404 is served from the cache", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		client := NewDefaultClient(Config{BaseURL: testServer.URL, CacheNotFoundTTL: time.Minute}, cache.NewDefaultCache(time.Hour, time.Hour))
+
+		_, upstreamErr := client.GetUserInfo(context.Background(), "999")
+		_, cachedErr := client.GetUserInfo(context.Background(), "999")
+		assert.Equal(t, upstreamErr, cachedErr)
+		assert.Equal(t, APIClientError{
+			StatusCode: http.StatusNotFound,
+			Body:       `{"error":"not found"}`,
+			Msg:        "API returned an error",
+			URL:        testServer.URL + "/users/999",
+		}, cachedErr)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("404 past the not found ttl is fetched", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		client := NewDefaultClient(Config{BaseURL: testServer.URL, CacheNotFoundTTL: time.Millisecond}, cache.NewDefaultCache(time.Hour, time.Hour))
+
+		_, err := client.GetUserPosts(context.Background(), "999", PostQuery{})
+		assert.Error(t, err)
+		time.Sleep(5 * time.Millisecond)
+		_, err = client.GetUserPosts(context.Background(), "999", PostQuery{})
+		assert.Error(t, err)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("404 is not cached when disabled", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		client := NewDefaultClient(Config{BaseURL: testServer.URL}, cache.NewDefaultCache(time.Hour, time.Hour))
+
+		_, _ = client.GetUserInfo(context.Background(), "999")
+		_, _ = client.GetUserInfo(context.Background(), "999")
+		assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+	})
+}
+
+func TestCacheRefresh(t *testing.T) {
+	var version int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(User{Id: 1, Name: fmt.Sprintf("Yolanda v%d", atomic.AddInt32(&version, 1))})
+	}))
+	defer testServer.Close()
+	client := NewDefaultClient(Config{BaseURL: testServer.URL}, cache.NewDefaultCache(time.Hour, time.Hour))
+
+	u, err := client.GetUserInfo(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Yolanda v1", u.Name)
+
+	u, err = client.GetUserInfo(WithCacheRefresh(context.Background()), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Yolanda v2", u.Name)
+
+	u, err = client.GetUserInfo(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Yolanda v2", u.Name)
+}
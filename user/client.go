@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 type User struct {
@@ -38,9 +41,200 @@ type Post struct {
 	Body   string `json:"body"`
 }
 
+// ListOptions selects a page of a listing and its sort order.
+type ListOptions struct {
+	Page  int
+	Limit int
+	// Sort is the field to sort by, the listing is returned in the API's order when empty.
+	Sort  string
+	// Order is either asc or desc.
+	Order string
+}
+
+// MaxListLimit is the largest page size accepted by ListOptions.
+const MaxListLimit = 100
+
+// userSortFields are the User fields a user listing can be sorted by.
+var userSortFields = map[string]bool{"id": true, "name": true, "username": true, "email": true}
+
+// Validate returns a ValidationError if the page, limit, sort field or order is out of range.
+func (in ListOptions) Validate() error {
+	if in.Page < 1 {
+		return ValidationError{Field: "page", Msg: "must be a positive integer"}
+	}
+	if in.Limit < 1 || in.Limit > MaxListLimit {
+		return ValidationError{Field: "limit", Msg: fmt.Sprintf("must be between 1 and %d", MaxListLimit)}
+	}
+	if in.Sort != "" && !userSortFields[in.Sort] {
+		return ValidationError{Field: "sort", Msg: "must be one of id, name, username or email"}
+	}
+	if in.Order != "asc" && in.Order != "desc" {
+		return ValidationError{Field: "order", Msg: "must be either asc or desc"}
+	}
+	return nil
+}
+
+// PostQuery filters and sorts the posts of a user. The zero PostQuery returns the posts as they are.
+type PostQuery struct {
+	// TitleContains only keeps the posts whose title contains it, ignoring case.
+	TitleContains string
+	// Sort is either id or title, the posts are returned in the API's order when empty.
+	Sort string
+	// Order is either asc or desc, and defaults to asc.
+	Order string
+}
+
+// Validate returns a ValidationError if the sort field or order is unknown.
+func (in PostQuery) Validate() error {
+	if in.Sort != "" && in.Sort != "id" && in.Sort != "title" {
+		return ValidationError{Field: "sort", Msg: "must be either id or title"}
+	}
+	if in.Order != "" && in.Order != "asc" && in.Order != "desc" {
+		return ValidationError{Field: "order", Msg: "must be either asc or desc"}
+	}
+	return nil
+}
+
+// Apply returns the posts matching the query in the requested order. The given posts are left untouched.
+func (in PostQuery) Apply(posts []Post) []Post {
+	if in.TitleContains == "" && in.Sort == "" {
+		return posts
+	}
+	titleContains := strings.ToLower(in.TitleContains)
+	filtered := make([]Post, 0, len(posts))
+	for _, p := range posts {
+		if strings.Contains(strings.ToLower(p.Title), titleContains) {
+			filtered = append(filtered, p)
+		}
+	}
+
+	less := func(i, j int) bool {
+		return filtered[i].Id < filtered[j].Id
+	}
+	if in.Sort == "title" {
+		less = func(i, j int) bool {
+			return strings.ToLower(filtered[i].Title) < strings.ToLower(filtered[j].Title)
+		}
+	}
+	if in.Sort != "" {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			if in.Order == "desc" {
+				return less(j, i)
+			}
+			return less(i, j)
+		})
+	}
+	return filtered
+}
+
+// UserList is a page of users along with the total number of users.
+type UserList struct {
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+}
+
+// PostInput is the body of a post that is created or replaced.
+type PostInput struct {
+	UserId int    `json:"userId"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+// Validate returns a ValidationError if the post is missing an owner, title or body.
+func (in PostInput) Validate() error {
+	if in.UserId <= 0 {
+		return ValidationError{Field: "userId", Msg: "must be a positive integer"}
+	}
+	if strings.TrimSpace(in.Title) == "" {
+		return ValidationError{Field: "title", Msg: "must not be empty"}
+	}
+	if strings.TrimSpace(in.Body) == "" {
+		return ValidationError{Field: "body", Msg: "must not be empty"}
+	}
+	return nil
+}
+
+// PostPatch is a partial update of a post. Only the non-nil fields are sent to the API.
+type PostPatch struct {
+	UserId *int    `json:"userId,omitempty"`
+	Title  *string `json:"title,omitempty"`
+	Body   *string `json:"body,omitempty"`
+}
+
+// Validate returns a ValidationError if the patch is empty or sets a field to an invalid value.
+func (in PostPatch) Validate() error {
+	if in.UserId == nil && in.Title == nil && in.Body == nil {
+		return ValidationError{Msg: "at least one of userId, title or body must be set"}
+	}
+	if in.UserId != nil && *in.UserId <= 0 {
+		return ValidationError{Field: "userId", Msg: "must be a positive integer"}
+	}
+	if in.Title != nil && strings.TrimSpace(*in.Title) == "" {
+		return ValidationError{Field: "title", Msg: "must not be empty"}
+	}
+	if in.Body != nil && strings.TrimSpace(*in.Body) == "" {
+		return ValidationError{Field: "body", Msg: "must not be empty"}
+	}
+	return nil
+}
+
+// ValidationError is returned when a request body sent through the Client is invalid.
+type ValidationError struct {
+	Field string
+	Msg   string
+}
+
+func (in ValidationError) Error() string {
+	if in.Field == "" {
+		return in.Msg
+	}
+	return fmt.Sprintf("%s %s", in.Field, in.Msg)
+}
+
+type Comment struct {
+	PostId int    `json:"postId"`
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Body   string `json:"body"`
+}
+
+type Album struct {
+	UserId int    `json:"userId"`
+	Id     int    `json:"id"`
+	Title  string `json:"title"`
+}
+
+type Photo struct {
+	AlbumId      int    `json:"albumId"`
+	Id           int    `json:"id"`
+	Title        string `json:"title"`
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnailUrl"`
+}
+
+type Todo struct {
+	UserId    int    `json:"userId"`
+	Id        int    `json:"id"`
+	Title     string `json:"title"`
+	Completed bool   `json:"completed"`
+}
+
 type Client interface {
 	GetUserInfo(ctx context.Context, userID string) (User, error)
-	GetUserPosts(ctx context.Context, userID string) ([]Post, error)
+	// GetUserPosts returns the posts of a user, filtered and sorted by the PostQuery.
+	GetUserPosts(ctx context.Context, userID string, q PostQuery) ([]Post, error)
+	GetPostComments(ctx context.Context, postID string) ([]Comment, error)
+	GetUserAlbums(ctx context.Context, userID string) ([]Album, error)
+	GetAlbumPhotos(ctx context.Context, albumID string) ([]Photo, error)
+	// GetUserTodos returns the todos of a user. A non-nil completed only returns the todos
+	// matching that completion state.
+	GetUserTodos(ctx context.Context, userID string, completed *bool) ([]Todo, error)
+	ListUsers(ctx context.Context, opts ListOptions) (UserList, error)
+	CreatePost(ctx context.Context, post PostInput) (Post, error)
+	UpdatePost(ctx context.Context, postID string, post PostInput) (Post, error)
+	PatchPost(ctx context.Context, postID string, patch PostPatch) (Post, error)
+	DeletePost(ctx context.Context, postID string) error
 }
 
 // CheckResponse checks an API response and returns and error if
@@ -58,6 +252,8 @@ type APIClientError struct {
 	Body string			`json:"body,omitempty"`
 	Msg string			`json:"msg,omitempty"`
 	URL string			`json:"url"`
+	// RetryAfter is the delay requested by the Retry-After header of the response, if any.
+	RetryAfter time.Duration	`json:"-"`
 }
 
 func NewAPIClientError(resp *http.Response, req *http.Request) APIClientError {
@@ -71,12 +267,14 @@ func NewAPIClientError(resp *http.Response, req *http.Request) APIClientError {
 			Body: j,
 			Msg: "API returned an error",
 			URL: req.URL.String(),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
 		}
 	}
 	return APIClientError{
 		StatusCode: resp.StatusCode,
 		Msg: "API returned an invalid or empty response",
 		URL: req.URL.String(),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
 	}
 }
 
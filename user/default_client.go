@@ -1,23 +1,91 @@
 package user
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/hashicorp/go-cleanhttp"
 	"github.com/hooliganlin/simple-go-rest-api/cache"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const (
 	userPostCacheKeyPrefix = "posts-user"
 	userCacheKeyPrefix = "user"
+	postCommentsCacheKeyPrefix = "comments-post"
+	userAlbumsCacheKeyPrefix = "albums-user"
+	albumPhotosCacheKeyPrefix = "photos-album"
+	userTodosCacheKeyPrefix = "todos-user"
+	usersListCacheKeyPrefix = "users-list"
 )
 
 type Config struct {
 	BaseURL string	`envconfig:"BASE_URL" default:"https://jsonplaceholder.typicode.com"`
+	// CacheSoftTTL is the age after which a cached response is stale. A stale response is served right away
+	// and refreshed in the background. Stale-while-revalidate is disabled when it is zero.
+	CacheSoftTTL time.Duration `envconfig:"CACHE_SOFT_TTL" default:"0s"`
+	// CacheHardTTL is the age after which a cached response is no longer served, even while the upstream API
+	// is failing. The default expiration of the cache applies when it is zero.
+	CacheHardTTL time.Duration `envconfig:"CACHE_HARD_TTL" default:"0s"`
+	// CacheStaleIfErrorTTL is how long a cached response is kept past the hard TTL, to be served while the circuit
+	// breaker is open. Expired responses are not kept when it is zero or when there is no hard TTL.
+	CacheStaleIfErrorTTL time.Duration `envconfig:"CACHE_STALE_IF_ERROR_TTL" default:"5m"`
+	// CacheNotFoundTTL is how long a 404 response of the upstream API is cached, so that repeated lookups of
+	// nonexistent resources are answered locally. Negative caching is disabled when it is zero.
+	CacheNotFoundTTL time.Duration `envconfig:"CACHE_NOT_FOUND_TTL" default:"30s"`
+	// RetryMaxAttempts is the number of attempts of a GET request failing with a connection error, a 429 or a
+	// 5xx response, including the first one. Requests are not retried when it is 1 or less.
+	RetryMaxAttempts int `envconfig:"RETRY_MAX_ATTEMPTS" default:"3"`
+	// RetryBaseDelay is the backoff before the first retry, doubled on every retry up to RetryMaxDelay and
+	// randomized with full jitter. A Retry-After header of the response takes precedence.
+	RetryBaseDelay time.Duration `envconfig:"RETRY_BASE_DELAY" default:"100ms"`
+	RetryMaxDelay  time.Duration `envconfig:"RETRY_MAX_DELAY" default:"2s"`
+	// RetryMaxElapsed caps the total time spent on the attempts of a request, unless it is zero.
+	RetryMaxElapsed time.Duration `envconfig:"RETRY_MAX_ELAPSED" default:"5s"`
+	// BreakerFailureThreshold is the number of consecutive connection errors or 5xx responses opening the circuit
+	// breaker, which fails requests right away for BreakerCooldown. BreakerSuccessThreshold consecutive probe
+	// requests must then succeed to close it again. The breaker is disabled when the failure threshold is zero.
+	BreakerFailureThreshold int           `envconfig:"BREAKER_FAILURE_THRESHOLD" default:"5"`
+	BreakerSuccessThreshold int           `envconfig:"BREAKER_SUCCESS_THRESHOLD" default:"1"`
+	BreakerCooldown         time.Duration `envconfig:"BREAKER_COOLDOWN" default:"30s"`
+	// RateLimit is the number of requests per second allowed to the upstream API, with bursts of up to
+	// RateLimitBurst requests. RateLimitUsers and RateLimitPosts additionally limit the requests to the users and
+	// posts endpoints. A request waits up to RateLimitMaxWait for the limit, and fails with a RateLimitedError
+	// otherwise. A rate of zero is not enforced.
+	RateLimit        float64       `envconfig:"RATE_LIMIT" default:"0"`
+	RateLimitBurst   int           `envconfig:"RATE_LIMIT_BURST" default:"10"`
+	RateLimitUsers   float64       `envconfig:"RATE_LIMIT_USERS" default:"0"`
+	RateLimitPosts   float64       `envconfig:"RATE_LIMIT_POSTS" default:"0"`
+	RateLimitMaxWait time.Duration `envconfig:"RATE_LIMIT_MAX_WAIT" default:"1s"`
+	// HedgeEnabled sends a second, identical GET request when the first one has not answered within the
+	// HedgePercentile of the recent latencies, or within HedgeInitialDelay until enough latencies are observed.
+	// The first response wins and the other request is cancelled. HedgeMaxPercent caps the share of the
+	// requests that are hedged.
+	HedgeEnabled      bool          `envconfig:"HEDGE_ENABLED" default:"false"`
+	HedgePercentile   float64       `envconfig:"HEDGE_PERCENTILE" default:"95"`
+	HedgeInitialDelay time.Duration `envconfig:"HEDGE_INITIAL_DELAY" default:"100ms"`
+	HedgeMaxPercent   float64       `envconfig:"HEDGE_MAX_PERCENT" default:"10"`
+	// CallTimeout is the deadline of a call to the upstream API, retries included, when the context of the
+	// call has none. This includes the fetches shared between callers and the background refreshes.
+	CallTimeout time.Duration `envconfig:"CALL_TIMEOUT" default:"15s"`
+	// RequestTimeout is the timeout of a single HTTP request, from dialing to reading the response body.
+	RequestTimeout        time.Duration `envconfig:"REQUEST_TIMEOUT" default:"10s"`
+	DialTimeout           time.Duration `envconfig:"DIAL_TIMEOUT" default:"5s"`
+	TLSHandshakeTimeout   time.Duration `envconfig:"TLS_HANDSHAKE_TIMEOUT" default:"5s"`
+	ResponseHeaderTimeout time.Duration `envconfig:"RESPONSE_HEADER_TIMEOUT" default:"5s"`
+	MaxIdleConns          int           `envconfig:"MAX_IDLE_CONNS" default:"100"`
+	MaxIdleConnsPerHost   int           `envconfig:"MAX_IDLE_CONNS_PER_HOST" default:"20"`
+	IdleConnTimeout       time.Duration `envconfig:"IDLE_CONN_TIMEOUT" default:"90s"`
+	DisableHTTP2          bool          `envconfig:"DISABLE_HTTP2" default:"false"`
 }
 
 func NewConfig() Config {
@@ -32,74 +100,305 @@ type DefaultClient struct {
 	baseURL string
 	client  *http.Client
 	cache 	cache.Cache
+	softTTL time.Duration
+	hardTTL time.Duration
+	staleIfErrorTTL time.Duration
+	notFoundTTL time.Duration
+	retry retryPolicy
+	breaker *circuitBreaker
+	callTimeout time.Duration
+	limiter *rateLimiter
+	hedger *hedger
+	// refreshing holds the cache keys that are being refreshed in the background
+	refreshing *sync.Map
+	// fetches coalesces the concurrent upstream fetches of a cache key
+	fetches *singleflight.Group
 }
 
 func NewDefaultClient(c Config, cache cache.Cache) Client {
-	client := http.Client{
-		Transport: cleanhttp.DefaultPooledTransport(),
-	}
 	return DefaultClient{
-		client:  &client,
+		client:  newHTTPClient(c),
 		baseURL: c.BaseURL,
 		cache: cache,
+		softTTL: c.CacheSoftTTL,
+		hardTTL: c.CacheHardTTL,
+		staleIfErrorTTL: c.CacheStaleIfErrorTTL,
+		notFoundTTL: c.CacheNotFoundTTL,
+		retry: newRetryPolicy(c),
+		breaker: newCircuitBreaker(c),
+		callTimeout: c.CallTimeout,
+		limiter: newRateLimiter(c),
+		hedger: newHedger(c),
+		refreshing: &sync.Map{},
+		fetches:    &singleflight.Group{},
 	}
 }
 
 // GetUserInfo fetches user information from the User API
 func(c DefaultClient) GetUserInfo(ctx context.Context, userID string) (User, error) {
-	// check cache first
-	cacheKey := userCacheKey(userID)
-	if u, ok := c.cache.Get(cacheKey); ok {
-		return u.(User), nil
+	var user User
+	err := c.getCached(ctx, userCacheKey(userID), &user, c.getFunc(fmt.Sprintf("%s/users/%s", c.baseURL, userID)))
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// GetUserPosts fetches posts for a user from the UserPost API. All of the user's posts are cached and the
+// PostQuery is applied to the cached list, so every query shares a single upstream call.
+func (c DefaultClient) GetUserPosts(ctx context.Context, userID string, q PostQuery) ([]Post, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	var posts []Post
+	if err := c.getCached(ctx, userPostsCacheKey(userID), &posts, c.getFunc(fmt.Sprintf("%s/posts?userId=%s", c.baseURL, userID))); err != nil {
+		return nil, err
+	}
+	return q.Apply(posts), nil
+}
+
+// GetPostComments fetches the comments of a post from the Comments API
+func (c DefaultClient) GetPostComments(ctx context.Context, postID string) ([]Comment, error) {
+	var comments []Comment
+	if err := c.getCached(ctx, postCommentsCacheKey(postID), &comments, c.getFunc(fmt.Sprintf("%s/posts/%s/comments", c.baseURL, postID))); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// GetUserAlbums fetches the albums of a user from the Albums API
+func (c DefaultClient) GetUserAlbums(ctx context.Context, userID string) ([]Album, error) {
+	var albums []Album
+	if err := c.getCached(ctx, userAlbumsCacheKey(userID), &albums, c.getFunc(fmt.Sprintf("%s/albums?userId=%s", c.baseURL, userID))); err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+// GetAlbumPhotos fetches the photos of an album from the Photos API
+func (c DefaultClient) GetAlbumPhotos(ctx context.Context, albumID string) ([]Photo, error) {
+	var photos []Photo
+	if err := c.getCached(ctx, albumPhotosCacheKey(albumID), &photos, c.getFunc(fmt.Sprintf("%s/albums/%s/photos", c.baseURL, albumID))); err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// GetUserTodos fetches the todos of a user from the Todos API. All of the user's todos are cached and the
+// completed filter is applied to the cached list, so both filters share a single upstream call.
+func (c DefaultClient) GetUserTodos(ctx context.Context, userID string, completed *bool) ([]Todo, error) {
+	var todos []Todo
+	if err := c.getCached(ctx, userTodosCacheKey(userID), &todos, c.getFunc(fmt.Sprintf("%s/todos?userId=%s", c.baseURL, userID))); err != nil {
+		return nil, err
+	}
+	return filterTodos(todos, completed), nil
+}
+
+// ListUsers fetches a page of users from the User API. The options are translated into the _page, _limit,
+// _sort and _order query parameters of the API, and the total number of users is read from the
+// X-Total-Count response header.
+func (c DefaultClient) ListUsers(ctx context.Context, opts ListOptions) (UserList, error) {
+	if err := opts.Validate(); err != nil {
+		return UserList{}, err
+	}
+	query := url.Values{}
+	query.Set("_page", strconv.Itoa(opts.Page))
+	query.Set("_limit", strconv.Itoa(opts.Limit))
+	if opts.Sort != "" {
+		query.Set("_sort", opts.Sort)
+		query.Set("_order", opts.Order)
+	}
+	fetch := func(ctx context.Context) ([]byte, error) {
+		var users []User
+		header, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("%s/users?%s", c.baseURL, query.Encode()), nil, &users)
+		if err != nil {
+			return nil, err
+		}
+		list := UserList{Users: users, Total: len(users)}
+		if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+			list.Total = total
+		}
+		return json.Marshal(list)
+	}
+
+	var list UserList
+	if err := c.getCached(ctx, usersListCacheKey(opts), &list, fetch); err != nil {
+		return UserList{}, err
 	}
+	return list, nil
+}
+
+// CreatePost creates a post through the Posts API and invalidates the cached posts of its owner.
+func (c DefaultClient) CreatePost(ctx context.Context, in PostInput) (Post, error) {
+	if err := in.Validate(); err != nil {
+		return Post{}, err
+	}
+	var post Post
+	if _, err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/posts", c.baseURL), in, &post); err != nil {
+		return Post{}, err
+	}
+	c.invalidatePosts(ctx, post.UserId)
+	return post, nil
+}
+
+// UpdatePost replaces a post through the Posts API and invalidates the cached posts of its previous
+// and new owner.
+func (c DefaultClient) UpdatePost(ctx context.Context, postID string, in PostInput) (Post, error) {
+	if err := in.Validate(); err != nil {
+		return Post{}, err
+	}
+	return c.writePost(ctx, http.MethodPut, postID, in)
+}
+
+// PatchPost partially updates a post through the Posts API and invalidates the cached posts of its
+// previous and new owner.
+func (c DefaultClient) PatchPost(ctx context.Context, postID string, patch PostPatch) (Post, error) {
+	if err := patch.Validate(); err != nil {
+		return Post{}, err
+	}
+	return c.writePost(ctx, http.MethodPatch, postID, patch)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/users/%s", c.baseURL, userID), nil)
+// DeletePost deletes a post through the Posts API and invalidates the cached posts of its owner along
+// with the cached comments of the post.
+func (c DefaultClient) DeletePost(ctx context.Context, postID string) error {
+	existing, err := c.getPost(ctx, postID)
 	if err != nil {
-		return User{}, err
+		return err
 	}
-	resp, err := c.client.Do(req)
+	if _, err = c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("%s/posts/%s", c.baseURL, postID), nil, nil); err != nil {
+		return err
+	}
+	c.invalidatePosts(ctx, existing.UserId)
+	c.cacheDelete(ctx, postCommentsCacheKey(postID))
+	return nil
+}
+
+// writePost sends an update of an existing post. The post is looked up first since the owner whose
+// cached posts must be invalidated is not necessarily part of the update.
+func (c DefaultClient) writePost(ctx context.Context, method string, postID string, body interface{}) (Post, error) {
+	existing, err := c.getPost(ctx, postID)
 	if err != nil {
-		return User{}, err
+		return Post{}, err
 	}
-	if err = checkResponse(resp); err != nil {
-		return User{}, err
+	var post Post
+	if _, err = c.doJSON(ctx, method, fmt.Sprintf("%s/posts/%s", c.baseURL, postID), body, &post); err != nil {
+		return Post{}, err
 	}
-	defer resp.Body.Close()
+	c.invalidatePosts(ctx, existing.UserId)
+	if post.UserId != existing.UserId {
+		c.invalidatePosts(ctx, post.UserId)
+	}
+	return post, nil
+}
 
-	var user User
-	if err = json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return User{}, err
+// getPost fetches a single post from the Posts API, bypassing the cache.
+func (c DefaultClient) getPost(ctx context.Context, postID string) (Post, error) {
+	var post Post
+	if err := c.getJSON(ctx, fmt.Sprintf("%s/posts/%s", c.baseURL, postID), &post); err != nil {
+		return Post{}, err
 	}
-	c.cache.Set(cacheKey, User{})
-	return user, nil
+	return post, nil
+}
+
+func (c DefaultClient) invalidatePosts(ctx context.Context, userID int) {
+	c.cacheDelete(ctx, userPostsCacheKey(strconv.Itoa(userID)))
+}
+
+// getJSON issues a GET request to url and decodes the JSON response body into v.
+func (c DefaultClient) getJSON(ctx context.Context, url string, v interface{}) error {
+	_, err := c.doJSON(ctx, http.MethodGet, url, nil, v)
+	return err
 }
 
-// GetUserPosts fetches posts for a user from the UserPost API
-func (c DefaultClient) GetUserPosts(ctx context.Context, userID string) ([]Post, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/posts?userId=%s", c.baseURL, userID), nil)
+// getFunc returns a fetchFunc issuing a GET request to url.
+func (c DefaultClient) getFunc(url string) fetchFunc {
+	return func(ctx context.Context) ([]byte, error) {
+		b, _, err := c.do(ctx, http.MethodGet, url, nil)
+		return b, err
+	}
+}
+
+// doJSON issues a request to url with body encoded as JSON, if any, and decodes the JSON response body
+// into v, if any. The response headers are returned for a successful response.
+func (c DefaultClient) doJSON(ctx context.Context, method string, url string, body interface{}, v interface{}) (http.Header, error) {
+	b, header, err := c.do(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
-	cacheKey := userPostsCacheKey(userID)
-	if p, ok := c.cache.Get(cacheKey); ok {
-		return p.([]Post), nil
+	if v == nil {
+		return header, nil
 	}
+	return header, json.Unmarshal(b, v)
+}
 
+// do issues a request to url with body encoded as JSON, if any, and returns the body and headers of a
+// successful response, within the call timeout if the context has no deadline. Every attempt waits for the
+// rate limiter and goes through the circuit breaker. A slow GET attempt is hedged by a second one, and failed
+// GET requests are retried according to the retry policy.
+func (c DefaultClient) do(ctx context.Context, method string, url string, body interface{}) ([]byte, http.Header, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.callTimeout)
+	defer cancel()
+	attempt := func(ctx context.Context) ([]byte, http.Header, error) {
+		if err := c.limiter.wait(ctx, endpointOf(c.baseURL, url)); err != nil {
+			return nil, nil, err
+		}
+		return c.breaker.do(ctx, func() ([]byte, http.Header, error) {
+			return c.doOnce(ctx, method, url, body)
+		})
+	}
+	if method != http.MethodGet {
+		return attempt(ctx)
+	}
+	return c.retry.doWithRetry(ctx, func() ([]byte, http.Header, error) {
+		return c.hedger.do(ctx, attempt)
+	})
+}
+
+// doOnce issues a single attempt of a request.
+func (c DefaultClient) doOnce(ctx context.Context, method string, url string, body interface{}) ([]byte, http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 	if err = checkResponse(resp); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, resp.Header, nil
+}
 
-	var posts []Post
-	if err = json.NewDecoder(resp.Body).Decode(&posts); err != nil {
-		return nil, err
+// filterTodos returns the todos matching the completed state, or all todos when completed is nil.
+func filterTodos(todos []Todo, completed *bool) []Todo {
+	if completed == nil {
+		return todos
+	}
+	filtered := make([]Todo, 0, len(todos))
+	for _, t := range todos {
+		if t.Completed == *completed {
+			filtered = append(filtered, t)
+		}
 	}
-	c.cache.Set(cacheKey, posts)
-	return posts, nil
+	return filtered
 }
 
 func userCacheKey(userID string) string {
@@ -107,4 +406,19 @@ func userCacheKey(userID string) string {
 }
 func userPostsCacheKey(userID string) string {
 	return fmt.Sprintf("%s-%s", userPostCacheKeyPrefix, userID)
+}
+func postCommentsCacheKey(postID string) string {
+	return fmt.Sprintf("%s-%s", postCommentsCacheKeyPrefix, postID)
+}
+func userAlbumsCacheKey(userID string) string {
+	return fmt.Sprintf("%s-%s", userAlbumsCacheKeyPrefix, userID)
+}
+func albumPhotosCacheKey(albumID string) string {
+	return fmt.Sprintf("%s-%s", albumPhotosCacheKeyPrefix, albumID)
+}
+func userTodosCacheKey(userID string) string {
+	return fmt.Sprintf("%s-%s", userTodosCacheKeyPrefix, userID)
+}
+func usersListCacheKey(opts ListOptions) string {
+	return fmt.Sprintf("%s-%d-%d-%s-%s", usersListCacheKeyPrefix, opts.Page, opts.Limit, opts.Sort, opts.Order)
 }
\ No newline at end of file
@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
 	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestGetUserInfo(t *testing.T) {
@@ -40,6 +44,77 @@ func TestGetUserInfo(t *testing.T) {
 		assert.Equal(t, expectedUser, u)
 	})
 
+	t.Run("cached user equals the fetched user", func(t *testing.T) {
+		expectedUser := User{
+			Id: 1,
+			Name: "Yolanda",
+			Username: "thunder_chunky",
+			Email: "yolanda@example.com",
+		}
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if err := json.NewEncoder(w).Encode(expectedUser); err != nil {
+				t.Error(err, "could not encode user to JSON")
+			}
+		}))
+		defer testServer.Close()
+
+		c := cache.NewDefaultCache(time.Minute, time.Minute)
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, c)
+
+		fetched, err := client.GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		var entry cacheEntry
+		ok, err := cache.GetJSON(context.Background(), c, userCacheKey("1"), &entry)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		var cachedUser User
+		assert.NoError(t, json.Unmarshal(entry.Value, &cachedUser))
+		assert.Equal(t, fetched, cachedUser)
+
+		cached, err := client.GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUser, cached)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("cached user survives a redis round trip", func(t *testing.T) {
+		expectedUser := User{
+			Id: 1,
+			Name: "Yolanda",
+			Username: "thunder_chunky",
+			Email: "yolanda@example.com",
+			Phone: "123-456-1234",
+		}
+		expectedUser.Address.City = "Gwenborough"
+		expectedUser.Address.Geo.Lat = "-37.3159"
+		expectedUser.Company.Name = "Romaguera-Crona"
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if err := json.NewEncoder(w).Encode(expectedUser); err != nil {
+				t.Error(err, "could not encode user to JSON")
+			}
+		}))
+		defer testServer.Close()
+
+		s := miniredis.RunT(t)
+		redisCache := cache.NewRedisCache(redis.NewClient(&redis.Options{Addr: s.Addr()}), "test", time.Minute)
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, redisCache)
+
+		for i := 0; i < 2; i++ {
+			u, err := client.GetUserInfo(context.Background(), "1")
+			assert.NoError(t, err)
+			assert.Equal(t, expectedUser, u)
+		}
+		assert.Equal(t, 1, requests)
+	})
+
 	t.Run("non http 2xx response", func(t *testing.T) {
 		handler := func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
@@ -60,6 +135,48 @@ func TestGetUserInfo(t *testing.T) {
 	})
 }
 
+func TestCacheFailure(t *testing.T) {
+	expectedUser := User{Id: 1, Name: "Yolanda"}
+	var requests int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if err := json.NewEncoder(w).Encode(expectedUser); err != nil {
+			t.Error(err, "could not encode user to JSON")
+		}
+	}))
+	defer testServer.Close()
+
+	client := NewDefaultClient(Config{
+		BaseURL: testServer.URL,
+	}, failingCache{})
+
+	for i := 0; i < 2; i++ {
+		u, err := client.GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUser, u)
+	}
+	assert.Equal(t, 2, requests)
+}
+
+// failingCache is a cache.Cache whose backend is unavailable.
+type failingCache struct{}
+
+func (c failingCache) Get(_ context.Context, _ string) (interface{}, bool, error) {
+	return nil, false, errors.New("cache unavailable")
+}
+func (c failingCache) Set(_ context.Context, _ string, _ interface{}) error {
+	return errors.New("cache unavailable")
+}
+func (c failingCache) SetWithTTL(_ context.Context, _ string, _ interface{}, _ time.Duration) error {
+	return errors.New("cache unavailable")
+}
+func (c failingCache) Delete(_ context.Context, _ string) error {
+	return errors.New("cache unavailable")
+}
+func (c failingCache) Clear(_ context.Context) error {
+	return errors.New("cache unavailable")
+}
+
 func TestGetUserPosts(t *testing.T) {
 	t.Run("http 200 response", func(t *testing.T) {
 		expectedPosts := []Post{
@@ -90,7 +207,7 @@ func TestGetUserPosts(t *testing.T) {
 			BaseURL: testServer.URL,
 		}, cache.NullCache{})
 
-		posts, err := client.GetUserPosts(context.Background(), "user_1")
+		posts, err := client.GetUserPosts(context.Background(), "user_1", PostQuery{})
 		if err != nil {
 			t.Error(err, "could not call getUserInfo")
 		}
@@ -110,7 +227,377 @@ func TestGetUserPosts(t *testing.T) {
 			BaseURL: testServer.URL,
 		}, cache.NullCache{})
 
-		_, err := client.GetUserPosts(context.Background(), "user_1")
+		_, err := client.GetUserPosts(context.Background(), "user_1", PostQuery{})
+		assert.Error(t, err)
+	})
+}
+
+func TestGetPostComments(t *testing.T) {
+	t.Run("http 200 response", func(t *testing.T) {
+		expectedComments := []Comment{
+			{
+				PostId: 1,
+				Id: 1,
+				Name: "Nice post",
+				Email: "commenter@example.com",
+				Body: "I agree with everything",
+			},
+		}
+		var requestPath string
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestPath = r.URL.Path
+			if err := json.NewEncoder(w).Encode(expectedComments); err != nil {
+				t.Error(err, "could not encode comments to JSON")
+			}
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NullCache{})
+
+		comments, err := client.GetPostComments(context.Background(), "1")
+		if err != nil {
+			t.Error(err, "could not call getPostComments")
+		}
+		assert.Equal(t, "/posts/1/comments", requestPath)
+		assert.Equal(t, expectedComments, comments)
+	})
+
+	t.Run("non http 2xx response", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NullCache{})
+
+		_, err := client.GetPostComments(context.Background(), "1")
+		assert.Error(t, err)
+	})
+}
+
+func TestGetUserAlbums(t *testing.T) {
+	t.Run("http 200 response is cached", func(t *testing.T) {
+		expectedAlbums := []Album{
+			{
+				UserId: 1,
+				Id: 1,
+				Title: "Summer",
+			},
+		}
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			assert.Equal(t, "/albums", r.URL.Path)
+			assert.Equal(t, "1", r.URL.Query().Get("userId"))
+			if err := json.NewEncoder(w).Encode(expectedAlbums); err != nil {
+				t.Error(err, "could not encode albums to JSON")
+			}
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NewDefaultCache(time.Minute, time.Minute))
+
+		for i := 0; i < 2; i++ {
+			albums, err := client.GetUserAlbums(context.Background(), "1")
+			if err != nil {
+				t.Error(err, "could not call getUserAlbums")
+			}
+			assert.Equal(t, expectedAlbums, albums)
+		}
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("non http 2xx response", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NullCache{})
+
+		_, err := client.GetUserAlbums(context.Background(), "1")
 		assert.Error(t, err)
 	})
 }
+
+func TestGetAlbumPhotos(t *testing.T) {
+	t.Run("http 200 response is cached", func(t *testing.T) {
+		expectedPhotos := []Photo{
+			{
+				AlbumId: 1,
+				Id: 1,
+				Title: "Beach",
+				Url: "https://via.placeholder.com/600/92c952",
+				ThumbnailUrl: "https://via.placeholder.com/150/92c952",
+			},
+		}
+		var requests int
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			assert.Equal(t, "/albums/1/photos", r.URL.Path)
+			if err := json.NewEncoder(w).Encode(expectedPhotos); err != nil {
+				t.Error(err, "could not encode photos to JSON")
+			}
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NewDefaultCache(time.Minute, time.Minute))
+
+		for i := 0; i < 2; i++ {
+			photos, err := client.GetAlbumPhotos(context.Background(), "1")
+			if err != nil {
+				t.Error(err, "could not call getAlbumPhotos")
+			}
+			assert.Equal(t, expectedPhotos, photos)
+		}
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("non http 2xx response", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NullCache{})
+
+		_, err := client.GetAlbumPhotos(context.Background(), "1")
+		assert.Error(t, err)
+	})
+}
+
+func TestGetUserTodos(t *testing.T) {
+	todos := []Todo{
+		{
+			UserId: 1,
+			Id: 1,
+			Title: "water plants",
+			Completed: true,
+		},
+		{
+			UserId: 1,
+			Id: 2,
+			Title: "walk the dog",
+		},
+	}
+	var requests int
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/todos", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("userId"))
+		if err := json.NewEncoder(w).Encode(todos); err != nil {
+			t.Error(err, "could not encode todos to JSON")
+		}
+	}))
+	defer testServer.Close()
+
+	client := NewDefaultClient(Config{
+		BaseURL: testServer.URL,
+	}, cache.NewDefaultCache(time.Minute, time.Minute))
+
+	completed, open := true, false
+	t.Run("all todos", func(t *testing.T) {
+		result, err := client.GetUserTodos(context.Background(), "1", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, todos, result)
+	})
+	t.Run("completed todos", func(t *testing.T) {
+		result, err := client.GetUserTodos(context.Background(), "1", &completed)
+		assert.NoError(t, err)
+		assert.Equal(t, []Todo{todos[0]}, result)
+	})
+	t.Run("open todos", func(t *testing.T) {
+		result, err := client.GetUserTodos(context.Background(), "1", &open)
+		assert.NoError(t, err)
+		assert.Equal(t, []Todo{todos[1]}, result)
+	})
+	assert.Equal(t, 1, requests)
+}
+
+func TestPostWrites(t *testing.T) {
+	existing := Post{UserId: 1, Id: 1, Title: "old title", Body: "old body"}
+	newTestServer := func(t *testing.T, methods *[]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*methods = append(*methods, r.Method)
+			switch r.Method {
+			case http.MethodGet:
+				_ = json.NewEncoder(w).Encode(existing)
+			case http.MethodDelete:
+				_, _ = w.Write([]byte("{}"))
+			default:
+				assert.Equal(t, "application/json; charset=UTF-8", r.Header.Get("Content-Type"))
+				var post Post
+				if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+					t.Error(err, "could not decode post")
+				}
+				post.Id = 101
+				if r.Method == http.MethodPost {
+					w.WriteHeader(http.StatusCreated)
+				} else {
+					post.Id = existing.Id
+				}
+				_ = json.NewEncoder(w).Encode(post)
+			}
+		}))
+	}
+	newCache := func() cache.Cache {
+		c := cache.NewDefaultCache(time.Minute, time.Minute)
+		_ = cache.SetJSON(context.Background(), c, userPostsCacheKey("1"), []Post{existing})
+		_ = cache.SetJSON(context.Background(), c, userPostsCacheKey("2"), []Post{})
+		_ = cache.SetJSON(context.Background(), c, postCommentsCacheKey("1"), []Comment{})
+		return c
+	}
+
+	t.Run("create post invalidates the owner's posts", func(t *testing.T) {
+		var methods []string
+		testServer := newTestServer(t, &methods)
+		defer testServer.Close()
+		c := newCache()
+		client := NewDefaultClient(Config{BaseURL: testServer.URL}, c)
+
+		post, err := client.CreatePost(context.Background(), PostInput{UserId: 1, Title: "title", Body: "body"})
+		assert.NoError(t, err)
+		assert.Equal(t, Post{UserId: 1, Id: 101, Title: "title", Body: "body"}, post)
+		assert.Equal(t, []string{http.MethodPost}, methods)
+		_, ok, _ := c.Get(context.Background(), userPostsCacheKey("1"))
+		assert.False(t, ok)
+	})
+
+	t.Run("invalid post is not sent", func(t *testing.T) {
+		var methods []string
+		testServer := newTestServer(t, &methods)
+		defer testServer.Close()
+		client := NewDefaultClient(Config{BaseURL: testServer.URL}, cache.NullCache{})
+
+		_, err := client.CreatePost(context.Background(), PostInput{UserId: 1, Title: " ", Body: "body"})
+		assert.Equal(t, ValidationError{Field: "title", Msg: "must not be empty"}, err)
+		assert.Empty(t, methods)
+	})
+
+	t.Run("update post invalidates the previous and new owner's posts", func(t *testing.T) {
+		var methods []string
+		testServer := newTestServer(t, &methods)
+		defer testServer.Close()
+		c := newCache()
+		client := NewDefaultClient(Config{BaseURL: testServer.URL}, c)
+
+		post, err := client.UpdatePost(context.Background(), "1", PostInput{UserId: 2, Title: "title", Body: "body"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, post.UserId)
+		assert.Equal(t, []string{http.MethodGet, http.MethodPut}, methods)
+		_, ok, _ := c.Get(context.Background(), userPostsCacheKey("1"))
+		assert.False(t, ok)
+		_, ok, _ = c.Get(context.Background(), userPostsCacheKey("2"))
+		assert.False(t, ok)
+	})
+
+	t.Run("patch post", func(t *testing.T) {
+		var methods []string
+		testServer := newTestServer(t, &methods)
+		defer testServer.Close()
+		c := newCache()
+		client := NewDefaultClient(Config{BaseURL: testServer.URL}, c)
+
+		title := "new title"
+		_, err := client.PatchPost(context.Background(), "1", PostPatch{Title: &title})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{http.MethodGet, http.MethodPatch}, methods)
+		_, ok, _ := c.Get(context.Background(), userPostsCacheKey("1"))
+		assert.False(t, ok)
+
+		_, err = client.PatchPost(context.Background(), "1", PostPatch{})
+		assert.IsType(t, ValidationError{}, err)
+	})
+
+	t.Run("delete post invalidates the owner's posts and the post's comments", func(t *testing.T) {
+		var methods []string
+		testServer := newTestServer(t, &methods)
+		defer testServer.Close()
+		c := newCache()
+		client := NewDefaultClient(Config{BaseURL: testServer.URL}, c)
+
+		assert.NoError(t, client.DeletePost(context.Background(), "1"))
+		assert.Equal(t, []string{http.MethodGet, http.MethodDelete}, methods)
+		_, ok, _ := c.Get(context.Background(), userPostsCacheKey("1"))
+		assert.False(t, ok)
+		_, ok, _ = c.Get(context.Background(), postCommentsCacheKey("1"))
+		assert.False(t, ok)
+		_, ok, _ = c.Get(context.Background(), userPostsCacheKey("2"))
+		assert.True(t, ok)
+	})
+}
+
+func TestListUsers(t *testing.T) {
+	users := []User{
+		{Id: 3, Name: "Clementine Bauch"},
+		{Id: 4, Name: "Patricia Lebsack"},
+	}
+
+	t.Run("http 200 response", func(t *testing.T) {
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/users", r.URL.Path)
+			assert.Equal(t, "_limit=2&_order=desc&_page=2&_sort=name", r.URL.RawQuery)
+			w.Header().Set("X-Total-Count", "10")
+			if err := json.NewEncoder(w).Encode(users); err != nil {
+				t.Error(err, "could not encode users to JSON")
+			}
+		}))
+		defer testServer.Close()
+
+		client := NewDefaultClient(Config{
+			BaseURL: testServer.URL,
+		}, cache.NullCache{})
+
+		list, err := client.ListUsers(context.Background(), ListOptions{Page: 2, Limit: 2, Sort: "name", Order: "desc"})
+		assert.NoError(t, err)
+		assert.Equal(t, UserList{Users: users, Total: 10}, list)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		client := NewDefaultClient(Config{}, cache.NullCache{})
+
+		_, err := client.ListUsers(context.Background(), ListOptions{Page: 1, Limit: 0, Order: "asc"})
+		assert.Equal(t, ValidationError{Field: "limit", Msg: "must be between 1 and 100"}, err)
+	})
+}
+
+func TestPostQuery(t *testing.T) {
+	posts := []Post{
+		{Id: 2, Title: "Banana bread"},
+		{Id: 1, Title: "apple pie"},
+		{Id: 3, Title: "Cherry Pie"},
+	}
+
+	t.Run("zero query", func(t *testing.T) {
+		assert.Equal(t, posts, PostQuery{}.Apply(posts))
+	})
+	t.Run("title contains ignores case", func(t *testing.T) {
+		assert.Equal(t, []Post{posts[1], posts[2]}, PostQuery{TitleContains: "PIE"}.Apply(posts))
+	})
+	t.Run("sort by id", func(t *testing.T) {
+		assert.Equal(t, []Post{posts[1], posts[0], posts[2]}, PostQuery{Sort: "id"}.Apply(posts))
+	})
+	t.Run("sort by title descending ignores case", func(t *testing.T) {
+		assert.Equal(t, []Post{posts[2], posts[0], posts[1]}, PostQuery{Sort: "title", Order: "desc"}.Apply(posts))
+	})
+	t.Run("does not reorder the given posts", func(t *testing.T) {
+		PostQuery{Sort: "id"}.Apply(posts)
+		assert.Equal(t, 2, posts[0].Id)
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		assert.Equal(t, ValidationError{Field: "sort", Msg: "must be either id or title"}, PostQuery{Sort: "body"}.Validate())
+		assert.Equal(t, ValidationError{Field: "order", Msg: "must be either asc or desc"}, PostQuery{Order: "up"}.Validate())
+	})
+}
@@ -0,0 +1,152 @@
+package user
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindowSize is the number of recent request latencies the hedging delay is computed from.
+	latencyWindowSize = 500
+	// minLatencySamples is the number of latencies observed before the initial hedging delay is replaced by
+	// the percentile of the observed latencies.
+	minLatencySamples = 20
+	// latencyRecomputeInterval is the number of observed latencies between two computations of the percentile.
+	latencyRecomputeInterval = 50
+	// maxHedgeCredits bounds the burst of hedged requests allowed after a period without hedging.
+	maxHedgeCredits = 10
+)
+
+// attemptFunc issues a single attempt of a request within ctx.
+type attemptFunc func(ctx context.Context) ([]byte, http.Header, error)
+
+// hedger sends a second, identical GET request when the first one has not answered within a percentile of
+// the recently observed latencies, and returns whichever succeeds first, cancelling the other. Every request
+// earns the max percent of a hedge, so that the hedged requests stay within that share of the traffic. A nil
+// hedger sends a single request.
+type hedger struct {
+	mu         sync.Mutex
+	percentile float64
+	maxPercent float64
+	credits    float64
+	latencies  []time.Duration
+	next       int
+	observed   int
+	delay      time.Duration
+}
+
+// newHedger returns nil unless hedging is enabled.
+func newHedger(c Config) *hedger {
+	if !c.HedgeEnabled {
+		return nil
+	}
+	return &hedger{
+		percentile: c.HedgePercentile,
+		maxPercent: c.HedgeMaxPercent,
+		latencies:  make([]time.Duration, 0, latencyWindowSize),
+		delay:      c.HedgeInitialDelay,
+	}
+}
+
+type attemptResult struct {
+	body   []byte
+	header http.Header
+	err    error
+}
+
+// do returns the first successful attempt, or the error of the last attempt to fail.
+func (h *hedger) do(ctx context.Context, attempt attemptFunc) ([]byte, http.Header, error) {
+	if h == nil {
+		return attempt(ctx)
+	}
+	// cancelling ctx on return cancels the attempt that lost
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, 2)
+	launch := func() {
+		go func() {
+			startTime := time.Now()
+			body, header, err := attempt(ctx)
+			if err == nil {
+				h.observe(time.Since(startTime))
+			}
+			results <- attemptResult{body: body, header: header, err: err}
+		}()
+	}
+	launch()
+	pending := 1
+	timer := time.NewTimer(h.earn())
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil || pending == 0 {
+				return res.body, res.header, res.err
+			}
+		case <-timer.C:
+			if h.spend() {
+				launch()
+				pending++
+			}
+		}
+	}
+}
+
+// earn credits the request with its share of a hedge and returns the current hedging delay.
+func (h *hedger) earn() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.credits = math.Min(h.credits+h.maxPercent/100, maxHedgeCredits)
+	return h.delay
+}
+
+// spend reports whether a hedge is within the budget, and takes it from the budget if so.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.credits < 1 {
+		return false
+	}
+	h.credits--
+	return true
+}
+
+// observe records the latency of a successful attempt, recomputing the hedging delay periodically.
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < latencyWindowSize {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+		h.next = (h.next + 1) % latencyWindowSize
+	}
+	h.observed++
+	if h.observed == minLatencySamples || (h.observed > minLatencySamples && h.observed%latencyRecomputeInterval == 0) {
+		h.delay = percentile(h.latencies, h.percentile)
+	}
+}
+
+// percentile returns the nearest-rank percentile of the latencies, from 0 to 100.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,87 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedging(t *testing.T) {
+	config := func(baseURL string, maxPercent float64) Config {
+		return Config{
+			BaseURL:           baseURL,
+			HedgeEnabled:      true,
+			HedgePercentile:   95,
+			HedgeInitialDelay: 20 * time.Millisecond,
+			HedgeMaxPercent:   maxPercent,
+		}
+	}
+	// newServer hangs on the first request until it is cancelled, and answers the others right away
+	newServer := func(requests *int32, cancelled chan<- struct{}) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(requests, 1) == 1 {
+				select {
+				case <-r.Context().Done():
+					close(cancelled)
+				case <-time.After(time.Second):
+				}
+				return
+			}
+			_ = json.NewEncoder(w).Encode(User{Id: 1})
+		}))
+	}
+
+	t.Run("slow request is hedged and cancelled", func(t *testing.T) {
+		var requests int32
+		cancelled := make(chan struct{})
+		testServer := newServer(&requests, cancelled)
+		defer testServer.Close()
+
+		startTime := time.Now()
+		u, err := NewDefaultClient(config(testServer.URL, 100), cache.NullCache{}).GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, u.Id)
+		assert.Less(t, int64(time.Since(startTime)), int64(500*time.Millisecond))
+		assert.EqualValues(t, 2, atomic.LoadInt32(&requests))
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Error("the slow request was not cancelled")
+		}
+	})
+
+	t.Run("hedges are capped", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, make(chan struct{}))
+		defer testServer.Close()
+
+		startTime := time.Now()
+		_, _ = NewDefaultClient(config(testServer.URL, 0), cache.NullCache{}).GetUserInfo(context.Background(), "1")
+		assert.GreaterOrEqual(t, int64(time.Since(startTime)), int64(time.Second))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+}
+
+func TestHedgingDelay(t *testing.T) {
+	h := newHedger(Config{HedgeEnabled: true, HedgePercentile: 90, HedgeInitialDelay: time.Second})
+	assert.Equal(t, time.Second, h.earn())
+	for i := 1; i <= minLatencySamples; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 18*time.Millisecond, h.earn())
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []time.Duration{5, 1, 4, 2, 3}
+	assert.Equal(t, time.Duration(1), percentile(latencies, 0))
+	assert.Equal(t, time.Duration(3), percentile(latencies, 50))
+	assert.Equal(t, time.Duration(5), percentile(latencies, 99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+	assert.Equal(t, []time.Duration{5, 1, 4, 2, 3}, latencies)
+}
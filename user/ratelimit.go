@@ -0,0 +1,118 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"strings"
+	"time"
+)
+
+// RateLimitedError is returned instead of calling the upstream API when the client-side rate limit does not
+// allow the call within the max wait of the limiter or the deadline of the context.
+type RateLimitedError struct {
+	// RetryAfter is the delay after which the call would have been allowed.
+	RetryAfter time.Duration
+}
+
+func (e RateLimitedError) Error() string {
+	return fmt.Sprintf("upstream API rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// rateLimiter is a token bucket limiting the calls to the upstream API as a whole, combined with the optional
+// token buckets of the users and posts endpoints. A nil rateLimiter allows every call.
+type rateLimiter struct {
+	global    *rate.Limiter
+	endpoints map[string]*rate.Limiter
+	// maxWait is how long a call may wait for the limiter before failing with a RateLimitedError.
+	maxWait time.Duration
+}
+
+// newRateLimiter returns nil when neither the global nor an endpoint rate limit is set.
+func newRateLimiter(c Config) *rateLimiter {
+	l := &rateLimiter{
+		global:    newLimiter(c.RateLimit, c.RateLimitBurst),
+		endpoints: make(map[string]*rate.Limiter),
+		maxWait:   c.RateLimitMaxWait,
+	}
+	if users := newLimiter(c.RateLimitUsers, c.RateLimitBurst); users != nil {
+		l.endpoints["users"] = users
+	}
+	if posts := newLimiter(c.RateLimitPosts, c.RateLimitBurst); posts != nil {
+		l.endpoints["posts"] = posts
+	}
+	if l.global == nil && len(l.endpoints) == 0 {
+		return nil
+	}
+	return l
+}
+
+// newLimiter returns nil when the rate is not positive. The burst is at least one call.
+func newLimiter(rps float64, burst int) *rate.Limiter {
+	if rps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+// wait blocks until the limiters of the endpoint allow a call. A call that would have to wait longer than
+// the max wait or past the deadline of the context gives its tokens back and fails right away.
+func (l *rateLimiter) wait(ctx context.Context, endpoint string) error {
+	if l == nil {
+		return nil
+	}
+	limiters := []*rate.Limiter{l.global, l.endpoints[endpoint]}
+	now := time.Now()
+	var reservations []*rate.Reservation
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	var delay time.Duration
+	for _, limiter := range limiters {
+		if limiter == nil {
+			continue
+		}
+		r := limiter.ReserveN(now, 1)
+		if !r.OK() {
+			cancel()
+			return RateLimitedError{}
+		}
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+	deadline, ok := ctx.Deadline()
+	if delay > l.maxWait || (ok && now.Add(delay).After(deadline)) {
+		cancel()
+		return RateLimitedError{RetryAfter: delay}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// endpointOf returns the first path segment of the url relative to the base url, such as users or posts.
+func endpointOf(baseURL string, url string) string {
+	path := strings.TrimPrefix(strings.TrimPrefix(url, baseURL), "/")
+	if i := strings.IndexAny(path, "/?"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
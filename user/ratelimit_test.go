@@ -0,0 +1,86 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/posts" {
+			_ = json.NewEncoder(w).Encode([]Post{})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(User{Id: 1})
+	}))
+	defer testServer.Close()
+	ctx := context.Background()
+
+	t.Run("calls wait for the limit", func(t *testing.T) {
+		client := NewDefaultClient(Config{
+			BaseURL:          testServer.URL,
+			RateLimit:        20,
+			RateLimitBurst:   1,
+			RateLimitMaxWait: time.Second,
+		}, cache.NullCache{})
+
+		startTime := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := client.GetUserInfo(ctx, "1")
+			assert.NoError(t, err)
+		}
+		assert.GreaterOrEqual(t, int64(time.Since(startTime)), int64(90*time.Millisecond))
+	})
+
+	t.Run("calls beyond the max wait are rejected", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		client := NewDefaultClient(Config{
+			BaseURL:        testServer.URL,
+			RateLimitUsers: 1,
+			RateLimitBurst: 1,
+		}, cache.NullCache{})
+
+		_, err := client.GetUserInfo(ctx, "1")
+		assert.NoError(t, err)
+		_, err = client.GetUserInfo(ctx, "2")
+		assert.IsType(t, RateLimitedError{}, err)
+		assert.Greater(t, int64(err.(RateLimitedError).RetryAfter), int64(0))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+		// the posts endpoint has its own budget
+		_, err = client.GetUserPosts(ctx, "1", PostQuery{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("calls waiting past the deadline are rejected", func(t *testing.T) {
+		client := NewDefaultClient(Config{
+			BaseURL:          testServer.URL,
+			RateLimit:        1,
+			RateLimitBurst:   1,
+			RateLimitMaxWait: time.Minute,
+		}, cache.NullCache{})
+		_, err := client.GetUserInfo(ctx, "1")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = client.CreatePost(ctx, PostInput{UserId: 1, Title: "title", Body: "body"})
+		assert.IsType(t, RateLimitedError{}, err)
+	})
+}
+
+func TestEndpointOf(t *testing.T) {
+	assert.Equal(t, "users", endpointOf("http://api/v1", "http://api/v1/users/1"))
+	assert.Equal(t, "posts", endpointOf("http://api/v1", "http://api/v1/posts?userId=1"))
+	assert.Equal(t, "posts", endpointOf("http://api/v1", "http://api/v1/posts/1/comments"))
+	assert.Equal(t, "todos", endpointOf("http://api/v1", "http://api/v1/todos"))
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy decides how often and how long after a failed GET request it is retried.
+type retryPolicy struct {
+	// maxAttempts is the number of attempts including the first one, so that at most one attempt is made
+	// when it is 1 or less.
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	// maxElapsed caps the time spent retrying a request, unless it is zero.
+	maxElapsed time.Duration
+}
+
+func newRetryPolicy(c Config) retryPolicy {
+	return retryPolicy{
+		maxAttempts: c.RetryMaxAttempts,
+		baseDelay:   c.RetryBaseDelay,
+		maxDelay:    c.RetryMaxDelay,
+		maxElapsed:  c.RetryMaxElapsed,
+	}
+}
+
+// doWithRetry calls attempt until it succeeds, fails with an error that is not retryable, or the attempts,
+// the time budget of the policy or the deadline of the context run out. The error of the last attempt is
+// returned.
+func (p retryPolicy) doWithRetry(ctx context.Context, attempt func() ([]byte, http.Header, error)) ([]byte, http.Header, error) {
+	startTime := time.Now()
+	for n := 1; ; n++ {
+		b, header, err := attempt()
+		if err == nil || n >= p.maxAttempts || !retryable(ctx, err) {
+			return b, header, err
+		}
+		delay := p.delay(n, err)
+		if p.maxElapsed > 0 && time.Since(startTime)+delay > p.maxElapsed {
+			return nil, nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return nil, nil, err
+		}
+		log.Debug().Err(err).Int("attempt", n).Dur("delay", delay).Msg("retrying upstream request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the Retry-After delay of a 429 or 503 response, and otherwise an exponential backoff with full
+// jitter, picked at random up to the base delay doubled on every attempt, capped by the max delay.
+func (p retryPolicy) delay(attempt int, err error) time.Duration {
+	var apiErr APIClientError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+	backoff := p.baseDelay << uint(attempt-1)
+	if backoff <= 0 || (p.maxDelay > 0 && backoff > p.maxDelay) {
+		backoff = p.maxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// retryable reports whether the error is a connection error, or an upstream 429 or 5xx response. Nothing is
+// retryable once the context is done, the circuit breaker is open or the rate limit is exceeded.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.As(err, &CircuitOpenError{}) || errors.As(err, &RateLimitedError{}) {
+		return false
+	}
+	var apiErr APIClientError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
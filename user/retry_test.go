@@ -0,0 +1,116 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	config := func(baseURL string) Config {
+		return Config{
+			BaseURL:          baseURL,
+			RetryMaxAttempts: 3,
+			RetryBaseDelay:   time.Millisecond,
+			RetryMaxDelay:    5 * time.Millisecond,
+			RetryMaxElapsed:  time.Second,
+		}
+	}
+	// newServer responds with the statuses in order, and with the user once they run out
+	newServer := func(requests *int32, header http.Header, statuses ...int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(requests, 1))
+			if n <= len(statuses) {
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(statuses[n-1])
+				return
+			}
+			_ = json.NewEncoder(w).Encode(User{Id: 1})
+		}))
+	}
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, nil, http.StatusBadGateway, http.StatusTooManyRequests)
+		defer testServer.Close()
+
+		u, err := NewDefaultClient(config(testServer.URL), cache.NullCache{}).GetUserInfo(context.Background(), "1")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, u.Id)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("attempts are capped", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+		defer testServer.Close()
+
+		_, err := NewDefaultClient(config(testServer.URL), cache.NullCache{}).GetUserInfo(context.Background(), "1")
+		assert.Equal(t, http.StatusBadGateway, err.(APIClientError).StatusCode)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, nil, http.StatusNotFound)
+		defer testServer.Close()
+
+		_, err := NewDefaultClient(config(testServer.URL), cache.NullCache{}).GetUserInfo(context.Background(), "1")
+		assert.Error(t, err)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("writes are not retried", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, nil, http.StatusBadGateway)
+		defer testServer.Close()
+
+		_, err := NewDefaultClient(config(testServer.URL), cache.NullCache{}).CreatePost(context.Background(), PostInput{UserId: 1, Title: "t", Body: "b"})
+		assert.Error(t, err)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("retry after beyond the time budget is not awaited", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, http.Header{"Retry-After": {"60"}}, http.StatusServiceUnavailable)
+		defer testServer.Close()
+
+		startTime := time.Now()
+		_, err := NewDefaultClient(config(testServer.URL), cache.NullCache{}).GetUserInfo(context.Background(), "1")
+		assert.Equal(t, time.Minute, err.(APIClientError).RetryAfter)
+		assert.Less(t, int64(time.Since(startTime)), int64(time.Second))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("context deadline is honored", func(t *testing.T) {
+		var requests int32
+		testServer := newServer(&requests, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+		defer testServer.Close()
+		c := config(testServer.URL)
+		c.RetryBaseDelay, c.RetryMaxDelay = time.Second, time.Second
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		startTime := time.Now()
+		_, err := NewDefaultClient(c, cache.NullCache{}).GetUserInfo(ctx, "1")
+		assert.Error(t, err)
+		assert.Less(t, int64(time.Since(startTime)), int64(time.Second))
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 2*time.Second, parseRetryAfter("2", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Mon, 01 Mar 2021 12:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Mon, 01 Mar 2021 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
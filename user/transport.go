@@ -0,0 +1,56 @@
+package user
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/hashicorp/go-cleanhttp"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialKeepAlive is the keep-alive period of the upstream connections.
+const dialKeepAlive = 30 * time.Second
+
+// newHTTPClient creates the http.Client of the upstream API. The transport settings left at zero in the
+// Config keep the defaults of cleanhttp.DefaultPooledTransport.
+func newHTTPClient(c Config) *http.Client {
+	transport := cleanhttp.DefaultPooledTransport()
+	if c.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   c.DialTimeout,
+			KeepAlive: dialKeepAlive,
+		}).DialContext
+	}
+	if c.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	if c.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	}
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.RequestTimeout,
+	}
+}
+
+// withDefaultTimeout bounds a context without a deadline by the timeout, unless it is zero.
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"context"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("zero values keep the defaults", func(t *testing.T) {
+		client := newHTTPClient(Config{})
+		transport := client.Transport.(*http.Transport)
+		assert.Equal(t, time.Duration(0), client.Timeout)
+		assert.Equal(t, 10*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, 100, transport.MaxIdleConns)
+		assert.True(t, transport.ForceAttemptHTTP2)
+	})
+
+	t.Run("configured values", func(t *testing.T) {
+		client := newHTTPClient(Config{
+			RequestTimeout:        time.Second,
+			DialTimeout:           time.Second,
+			TLSHandshakeTimeout:   2 * time.Second,
+			ResponseHeaderTimeout: 3 * time.Second,
+			MaxIdleConns:          7,
+			MaxIdleConnsPerHost:   3,
+			IdleConnTimeout:       time.Minute,
+			DisableHTTP2:          true,
+		})
+		transport := client.Transport.(*http.Transport)
+		assert.Equal(t, time.Second, client.Timeout)
+		assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, 3*time.Second, transport.ResponseHeaderTimeout)
+		assert.Equal(t, 7, transport.MaxIdleConns)
+		assert.Equal(t, 3, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+		assert.False(t, transport.ForceAttemptHTTP2)
+		assert.NotNil(t, transport.TLSNextProto)
+	})
+}
+
+func TestCallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer testServer.Close()
+	defer close(release)
+	client := NewDefaultClient(Config{BaseURL: testServer.URL, CallTimeout: 50 * time.Millisecond}, cache.NullCache{})
+
+	t.Run("call without deadline", func(t *testing.T) {
+		startTime := time.Now()
+		_, err := client.GetUserInfo(context.Background(), "1")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, int64(time.Since(startTime)), int64(time.Second))
+	})
+
+	t.Run("deadline of the context takes precedence", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		startTime := time.Now()
+		_, err := client.CreatePost(ctx, PostInput{UserId: 1, Title: "title", Body: "body"})
+		assert.Error(t, err)
+		assert.GreaterOrEqual(t, int64(time.Since(startTime)), int64(150*time.Millisecond))
+	})
+}
@@ -0,0 +1,90 @@
+package warmup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxRangeSize limits the number of ids of a single range, guarding against a mistyped bound.
+const maxRangeSize = 100000
+
+// ParseIDs expands the specs into a list of user ids without duplicates, in the order of the specs. A spec is
+// either a single id such as 7, or an inclusive range of ids such as 1-10.
+func ParseIDs(specs []string) ([]string, error) {
+	seen := make(map[int]bool)
+	var ids []string
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, err := parseSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		for id := first; id <= last; id++ {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, strconv.Itoa(id))
+			}
+		}
+	}
+	return ids, nil
+}
+
+// ReadSeedFile reads the specs of a seed file, one or more comma separated specs per line. Blank lines and
+// lines starting with # are skipped.
+func ReadSeedFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var specs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, strings.Split(line, ",")...)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+func parseSpec(spec string) (int, int, error) {
+	bounds := strings.SplitN(spec, "-", 2)
+	first, err := parseID(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid user id spec %q: %v", spec, err)
+	}
+	if len(bounds) == 1 {
+		return first, first, nil
+	}
+	last, err := parseID(bounds[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid user id spec %q: %v", spec, err)
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("invalid user id spec %q: the range is reversed", spec)
+	}
+	if last-first >= maxRangeSize {
+		return 0, 0, fmt.Errorf("invalid user id spec %q: the range exceeds %d ids", spec, maxRangeSize)
+	}
+	return first, last, nil
+}
+
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%q is not a positive integer", s)
+	}
+	return id, nil
+}
@@ -0,0 +1,31 @@
+package warmup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIDs(t *testing.T) {
+	ids, err := ParseIDs([]string{"3", " 1-4 ", "", "10-10"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "1", "2", "4", "10"}, ids)
+
+	for _, spec := range []string{"abc", "0", "-3", "5-2", "1-", "1-1000000"} {
+		_, err = ParseIDs([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestReadSeedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# most requested users\n1-3\n\n7,9\n"), 0o600))
+
+	specs, err := ReadSeedFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1-3", "7", "9"}, specs)
+
+	_, err = ReadSeedFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package warmup
+
+import (
+	"context"
+	"fmt"
+	"github.com/hooliganlin/simple-go-rest-api/user"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/semaphore"
+	"sync"
+	"time"
+)
+
+// Warmer preloads the cache of a user.Client with the info and posts of a set of users, so that the first
+// requests for those users do not wait on the upstream API.
+type Warmer struct {
+	client        user.Client
+	userIDs       []string
+	maxConcurrent int64
+	logger        zerolog.Logger
+}
+
+// NewWarmer creates a Warmer fetching at most maxConcurrent users at once.
+func NewWarmer(client user.Client, userIDs []string, maxConcurrent int, logger zerolog.Logger) Warmer {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return Warmer{
+		client:        client,
+		userIDs:       userIDs,
+		maxConcurrent: int64(maxConcurrent),
+		logger:        logger,
+	}
+}
+
+// Run refreshes the cache on every interval until ctx is done, starting one interval from now. Every run
+// fetches the users from the upstream API and overwrites their cached responses, so that they do not expire
+// as long as the interval is shorter than the TTL of the cache.
+func (w Warmer) Run(ctx context.Context, interval time.Duration) {
+	ctx = user.WithCacheRefresh(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.Warm(ctx); err != nil {
+			w.logger.Warn().Err(err).Msg("unable to warm up the cache")
+		}
+	}
+}
+
+// Warm fetches the info and posts of every user through the client. Every user is attempted even if some
+// fail, and the failures are logged and reported as a single error.
+func (w Warmer) Warm(ctx context.Context) error {
+	startTime := time.Now()
+	sem := semaphore.NewWeighted(w.maxConcurrent)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+
+	for _, id := range w.userIDs {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			if err := w.warmUser(ctx, id); err != nil {
+				w.logger.Warn().Err(err).Str("userId", id).Msg("unable to warm up the cache of user")
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed to warm up", failed, len(w.userIDs))
+	}
+	w.logger.Info().
+		Int("users", len(w.userIDs)).
+		Str("duration", fmt.Sprintf("%.4fms", time.Since(startTime).Seconds()*1000)).
+		Msg("warmed up the cache")
+	return nil
+}
+
+func (w Warmer) warmUser(ctx context.Context, id string) error {
+	if _, err := w.client.GetUserInfo(ctx, id); err != nil {
+		return err
+	}
+	_, err := w.client.GetUserPosts(ctx, id, user.PostQuery{})
+	return err
+}
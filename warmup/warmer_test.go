@@ -0,0 +1,101 @@
+package warmup
+
+import (
+	"context"
+	"github.com/hooliganlin/simple-go-rest-api/cache"
+	"github.com/hooliganlin/simple-go-rest-api/user"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarm(t *testing.T) {
+	t.Run("fetches every user with bounded concurrency", func(t *testing.T) {
+		client := &fakeClient{delay: 5 * time.Millisecond}
+		w := NewWarmer(client, []string{"1", "2", "3", "4", "5", "6"}, 2, zerolog.New(io.Discard))
+		assert.NoError(t, w.Warm(context.Background()))
+
+		sort.Strings(client.users)
+		assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, client.users)
+		assert.Equal(t, client.users, client.sortedPosts())
+		assert.LessOrEqual(t, client.maxInFlight, int32(2))
+	})
+
+	t.Run("reports failed users", func(t *testing.T) {
+		client := &fakeClient{failing: "2"}
+		w := NewWarmer(client, []string{"1", "2", "3"}, 2, zerolog.New(io.Discard))
+		assert.EqualError(t, w.Warm(context.Background()), "1 of 3 users failed to warm up")
+		assert.Len(t, client.users, 3)
+	})
+}
+
+func TestRun(t *testing.T) {
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/1" {
+			atomic.AddInt32(&requests, 1)
+			_, _ = w.Write([]byte(`{"id":1}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer testServer.Close()
+	client := user.NewDefaultClient(user.Config{BaseURL: testServer.URL}, cache.NewDefaultCache(time.Hour, time.Hour))
+	w := NewWarmer(client, []string{"1"}, 1, zerolog.New(io.Discard))
+	assert.NoError(t, w.Warm(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	w.Run(ctx, 10*time.Millisecond)
+	assert.Greater(t, atomic.LoadInt32(&requests), int32(2), "cached users are refreshed on every run")
+}
+
+// fakeClient records the users and posts fetched by a Warmer.
+type fakeClient struct {
+	user.Client
+	delay    time.Duration
+	failing  string
+	mu       sync.Mutex
+	users    []string
+	posts    []string
+	inFlight int32
+	// maxInFlight is the highest number of concurrent GetUserInfo calls
+	maxInFlight int32
+}
+
+func (c *fakeClient) GetUserInfo(_ context.Context, userID string) (user.User, error) {
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n > c.maxInFlight {
+		c.maxInFlight = n
+	}
+	c.users = append(c.users, userID)
+	if userID == c.failing {
+		return user.User{}, errors.New("upstream unavailable")
+	}
+	return user.User{}, nil
+}
+
+func (c *fakeClient) GetUserPosts(_ context.Context, userID string, _ user.PostQuery) ([]user.Post, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posts = append(c.posts, userID)
+	return nil, nil
+}
+
+func (c *fakeClient) sortedPosts() []string {
+	sort.Strings(c.posts)
+	return c.posts
+}